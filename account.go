@@ -0,0 +1,521 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// masa berlaku link konfirmasi hapus akun
+const deleteAccountTokenTTL = 24 * time.Hour
+
+// jeda antara konfirmasi hapus akun dan purge permanen (ACCOUNT_DELETION_GRACE)
+var accountDeletionGrace = 14 * 24 * time.Hour
+
+// =======================================
+// EXPORT data pribadi (zip: JSON + CSV)
+// =======================================
+func exportMyData(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	user, err := getUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	orgs, err := userOrganizations(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	profitLosses, err := userProfitLosses(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	items, err := userProfitLossItems(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	categories, err := userCategories(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	tickets, err := userTickets(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	plRows := [][]string{{"id", "organization_id", "date", "revenue", "expense", "profitloss"}}
+	for _, pl := range profitLosses {
+		plRows = append(plRows, []string{
+			strconv.Itoa(pl.ID), strconv.Itoa(pl.OrganizationID), pl.Date,
+			formatAmount(pl.Revenue), formatAmount(pl.Expense), formatAmount(pl.ProfitLoss),
+		})
+	}
+	itemRows := [][]string{{"id", "profit_loss_id", "organization_id", "date", "category_id", "category", "type", "amount", "note"}}
+	for _, it := range items {
+		itemRows = append(itemRows, []string{
+			strconv.Itoa(it.ID), strconv.Itoa(it.ProfitLossID), strconv.Itoa(it.OrganizationID), it.Date,
+			strconv.Itoa(it.CategoryID), it.Category, it.Type, formatAmount(it.Amount), it.Note,
+		})
+	}
+	ticketRows := [][]string{{"id", "organization_id", "product_id", "description", "status", "created_at", "updated_at"}}
+	for _, t := range tickets {
+		ticketRows = append(ticketRows, []string{
+			strconv.Itoa(t.ID), strconv.Itoa(t.OrganizationID), strconv.Itoa(t.ProductID),
+			t.Description, t.Status, t.CreatedAt, t.UpdatedAt,
+		})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data any // di-encode JSON, atau [][]string untuk CSV
+		csv  bool
+	}{
+		{"profile.json", fiber.Map{"user": user, "organizations": orgs}, false},
+		{"profit_losses.json", profitLosses, false},
+		{"profit_losses.csv", plRows, true},
+		{"profit_loss_items.json", items, false},
+		{"profit_loss_items.csv", itemRows, true},
+		{"categories.json", categories, false},
+		{"tickets.json", tickets, false},
+		{"tickets.csv", ticketRows, true},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if f.csv {
+			err = csv.NewWriter(w).WriteAll(f.data.([][]string))
+		} else {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	filename := fmt.Sprintf("mydash-export-%d-%s.zip", userID, time.Now().Format("20060102"))
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Send(buf.Bytes())
+}
+
+func userOrganizations(userID int) ([]Organization, error) {
+	rows, err := db.Query(`
+		SELECT o.id, o.name, m.role
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = ?
+		ORDER BY o.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		var o Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.Role); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+// data laba rugi yang dicatat user (semua organisasi)
+func userProfitLosses(userID int) ([]ProfitLoss, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, organization_id, date, revenue, expense, profitloss
+		FROM profit_losses
+		WHERE user_id = ?
+		ORDER BY date
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []ProfitLoss{}
+	for rows.Next() {
+		var pl ProfitLoss
+		if err := rows.Scan(&pl.ID, &pl.UserID, &pl.OrganizationID, &pl.Date, &pl.Revenue, &pl.Expense, &pl.ProfitLoss); err != nil {
+			return nil, err
+		}
+		result = append(result, pl)
+	}
+	return result, rows.Err()
+}
+
+// rincian line item dari data laba rugi yang dicatat user, hanya di organisasi
+// yang masih diikuti (sama dengan categories)
+type exportedItem struct {
+	ProfitLossItem
+	ProfitLossID   int    `json:"profit_loss_id"`
+	OrganizationID int    `json:"organization_id"`
+	Date           string `json:"date"`
+}
+
+func userProfitLossItems(userID int) ([]exportedItem, error) {
+	rows, err := db.Query(`
+		SELECT i.id, i.profit_loss_id, pl.organization_id, pl.date, i.category_id, c.name, c.type, i.amount, i.note
+		FROM profit_loss_items i
+		JOIN profit_losses pl ON pl.id = i.profit_loss_id
+		JOIN categories c ON c.id = i.category_id
+		JOIN organization_members m ON m.organization_id = pl.organization_id AND m.user_id = pl.user_id
+		WHERE pl.user_id = ?
+		ORDER BY pl.date, i.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []exportedItem{}
+	for rows.Next() {
+		var it exportedItem
+		if err := rows.Scan(&it.ID, &it.ProfitLossID, &it.OrganizationID, &it.Date,
+			&it.CategoryID, &it.Category, &it.Type, &it.Amount, &it.Note); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+type exportedCategory struct {
+	Category
+	OrganizationID int `json:"organization_id"`
+}
+
+// kategori milik organisasi user
+func userCategories(userID int) ([]exportedCategory, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.type, c.organization_id
+		FROM categories c
+		JOIN organization_members m ON m.organization_id = c.organization_id
+		WHERE m.user_id = ?
+		ORDER BY c.organization_id, c.type DESC, c.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []exportedCategory{}
+	for rows.Next() {
+		var ct exportedCategory
+		if err := rows.Scan(&ct.ID, &ct.Name, &ct.Type, &ct.OrganizationID); err != nil {
+			return nil, err
+		}
+		categories = append(categories, ct)
+	}
+	return categories, rows.Err()
+}
+
+func userTickets(userID int) ([]Ticket, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, organization_id, product_id, description, status, created_at, updated_at
+		FROM tickets
+		WHERE user_id = ?
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []Ticket{}
+	for rows.Next() {
+		var t Ticket
+		if err := rows.Scan(&t.ID, &t.UserID, &t.OrganizationID, &t.ProductID, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, rows.Err()
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// =======================================
+// HAPUS AKUN: minta link konfirmasi
+// =======================================
+func requestAccountDeletion(c *fiber.Ctx) error {
+	req := new(struct {
+		Password string `json:"password"`
+	})
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	userID := currentUserID(c)
+	var name, email, locale, hashedPassword string
+	err := db.QueryRow("SELECT name, email, locale, password FROM users WHERE id = ?", userID).
+		Scan(&name, &email, &locale, &hashedPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "password is incorrect"})
+	}
+
+	// organisasi bersama tidak boleh ditinggal tanpa owner
+	if orgID, err := soleOwnerOfSharedOrg(userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	} else if orgID != 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error":           "transfer ownership before deleting your account",
+			"organization_id": orgID,
+		})
+	}
+
+	throttled, err := userTokenThrottled(userID, purposeDeleteAccount, time.Minute, 5)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if throttled {
+		c.Set(fiber.HeaderRetryAfter, "60")
+		return c.Status(429).JSON(fiber.Map{"error": "too many requests, please wait before requesting another email"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	token, err := createUserToken(tx, userID, purposeDeleteAccount, deleteAccountTokenTTL)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	msg, err := renderEmail("delete_account", locale, email, map[string]any{
+		"Name":      name,
+		"Link":      deleteAccountLink(token),
+		"GraceDays": int(accountDeletionGrace.Hours() / 24),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "please check your email to confirm account deletion"})
+}
+
+// =======================================
+// HAPUS AKUN: konfirmasi (link dari email)
+// =======================================
+// Akun dijadwalkan dihapus setelah masa tenggang; sampai saat itu user masih
+// bisa login dan membatalkan lewat DELETE /api/me/delete.
+func confirmAccountDeletionHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(400).SendString("Invalid confirmation link")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).SendString("Failed to delete account")
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, purposeDeleteAccount, token)
+	if err != nil {
+		if err == errUserTokenInvalid {
+			return c.Status(400).SendString("Invalid or expired confirmation link")
+		}
+		return c.Status(500).SendString("Failed to delete account")
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET delete_after = ? WHERE id = ? AND delete_after IS NULL",
+		time.Now().Add(accountDeletionGrace), userID,
+	)
+	if err != nil {
+		return c.Status(500).SendString("Failed to delete account")
+	}
+	// semua sesi di perangkat lain diakhiri
+	if err := revokeAllSessions(tx, userID); err != nil {
+		return c.Status(500).SendString("Failed to delete account")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).SendString("Failed to delete account")
+	}
+
+	return c.Redirect(frontendURL()+"?account=deletion-scheduled", fiber.StatusSeeOther)
+}
+
+// =======================================
+// HAPUS AKUN: batalkan selama masa tenggang
+// =======================================
+func cancelAccountDeletion(c *fiber.Ctx) error {
+	err := execOwned(
+		"UPDATE users SET delete_after = NULL WHERE id = ? AND delete_after IS NOT NULL",
+		currentUserID(c),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "no pending account deletion"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "account deletion cancelled"})
+}
+
+func deleteAccountLink(token string) string {
+	apiURL := os.Getenv("VPS_APP_URL")
+	return fmt.Sprintf("%sapi/me/delete/confirm?token=%s", apiURL, token)
+}
+
+// id organisasi yang punya anggota lain tapi user satu-satunya owner (0 kalau tidak ada)
+func soleOwnerOfSharedOrg(userID int) (int, error) {
+	var orgID int
+	err := db.QueryRow(`
+		SELECT m.organization_id
+		FROM organization_members m
+		WHERE m.user_id = ? AND m.role = ?
+			AND EXISTS (SELECT 1 FROM organization_members o
+				WHERE o.organization_id = m.organization_id AND o.user_id <> m.user_id)
+			AND NOT EXISTS (SELECT 1 FROM organization_members o
+				WHERE o.organization_id = m.organization_id AND o.user_id <> m.user_id AND o.role = ?)
+		LIMIT 1
+	`, userID, orgRoleOwner, orgRoleOwner).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return orgID, err
+}
+
+// =======================================
+// WORKER: purge akun yang masa tenggangnya habis
+// =======================================
+func startAccountPurgeWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := purgeDeletedAccounts(); err != nil {
+				log.Println("account purge:", err)
+			}
+		}
+	}()
+}
+
+func purgeDeletedAccounts() error {
+	rows, err := db.Query("SELECT id FROM users WHERE delete_after IS NOT NULL AND delete_after <= ?", time.Now())
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := purgeAccount(id); err != nil {
+			log.Printf("account purge: user %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// hapus permanen user + data pribadinya. Organisasi yang hanya berisi user ini
+// ikut dihapus beserta datanya; data di organisasi bersama tetap milik organisasi.
+func purgeAccount(userID int) error {
+	// owner baru bisa saja belum ditunjuk sejak konfirmasi; coba lagi di putaran berikutnya
+	if orgID, err := soleOwnerOfSharedOrg(userID); err != nil {
+		return err
+	} else if orgID != 0 {
+		return fmt.Errorf("still sole owner of organization %d", orgID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// organisasi pribadi (tidak ada anggota lain)
+	soloOrgs := `SELECT organization_id FROM (
+		SELECT m.organization_id FROM organization_members m
+		WHERE m.user_id = ? AND NOT EXISTS (SELECT 1 FROM organization_members o
+			WHERE o.organization_id = m.organization_id AND o.user_id <> m.user_id)
+	) solo`
+	stmts := []string{
+		`DELETE i FROM profit_loss_items i JOIN profit_losses pl ON pl.id = i.profit_loss_id
+			WHERE pl.organization_id IN (` + soloOrgs + ")",
+		"DELETE FROM profit_losses WHERE organization_id IN (" + soloOrgs + ")",
+		"DELETE FROM categories WHERE organization_id IN (" + soloOrgs + ")",
+		"DELETE FROM tickets WHERE organization_id IN (" + soloOrgs + ")",
+		"DELETE FROM api_keys WHERE organization_id IN (" + soloOrgs + ")",
+		"DELETE FROM organization_invitations WHERE organization_id IN (" + soloOrgs + ")",
+		"DELETE FROM organizations WHERE id IN (" + soloOrgs + ")",
+		// data di organisasi bersama milik organisasi, bukan user: tetap ada, tanpa jejak user
+		"UPDATE profit_losses SET user_id = 0 WHERE user_id = ?",
+		"UPDATE tickets SET user_id = 0 WHERE user_id = ?",
+		// data yang hanya terhubung lewat alamat email (harus sebelum baris users dihapus)
+		"DELETE FROM email_outbox WHERE to_address = (SELECT email FROM users WHERE id = ?)",
+		"DELETE FROM organization_invitations WHERE email = (SELECT email FROM users WHERE id = ?)",
+		"DELETE FROM auth_audit_log WHERE email = (SELECT email FROM users WHERE id = ?)",
+		"DELETE FROM organization_members WHERE user_id = ?",
+		"DELETE FROM api_keys WHERE user_id = ?",
+		"DELETE FROM idempotency_keys WHERE user_id = ?",
+		"DELETE FROM refresh_tokens WHERE user_id = ?",
+		"DELETE FROM user_tokens WHERE user_id = ?",
+		"DELETE FROM user_two_factor WHERE user_id = ?",
+		"DELETE FROM two_factor_recovery_codes WHERE user_id = ?",
+		"DELETE FROM user_product_entitlements WHERE user_id = ?",
+		"DELETE FROM auth_audit_log WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	}
+	for _, q := range stmts {
+		if _, err := tx.Exec(q, userID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("account purge: user %d deleted", userID)
+	return nil
+}
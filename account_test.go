@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// export berisi line item + kategori organisasi user, selain data laba rugi & tiket
+func TestExportMyDataIncludesItemsAndCategories(t *testing.T) {
+	mock := newMockDB(t)
+
+	expectUserByID(mock)
+	mock.ExpectQuery(q("FROM organization_members m")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "role"}).AddRow(tenantOrgA, "Toko Budi", orgRoleOwner))
+	mock.ExpectQuery(q("FROM profit_losses")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "date", "revenue", "expense", "profitloss"}).
+			AddRow(tenantRowID, tenantUserA, tenantOrgA, "2025-03-01", 500.0, 200.0, 300.0))
+	mock.ExpectQuery(q("FROM profit_loss_items i")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "profit_loss_id", "organization_id", "date", "category_id", "name", "type", "amount", "note"}).
+			AddRow(1, tenantRowID, tenantOrgA, "2025-03-01", 3, "Penjualan", categoryIncome, 500.0, "").
+			AddRow(2, tenantRowID, tenantOrgA, "2025-03-01", 4, "Sewa", categoryExpense, 200.0, "Maret"))
+	mock.ExpectQuery(q("FROM categories c")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "type", "organization_id"}).
+			AddRow(3, "Penjualan", categoryIncome, tenantOrgA).
+			AddRow(4, "Sewa", categoryExpense, tenantOrgA))
+	mock.ExpectQuery(q("FROM tickets")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "product_id", "description", "status", "created_at", "updated_at"}))
+
+	app := newTestApp(tenantUserA, 0, "")
+	app.Get("/api/me/export", exportMyData)
+
+	resp, body := doRequest(t, app, "GET", "/api/me/export", "")
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader([]byte(body)), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var items []exportedItem
+	if err := json.Unmarshal(files["profit_loss_items.json"], &items); err != nil || len(items) != 2 {
+		t.Fatalf("profit_loss_items.json = %s (%v)", files["profit_loss_items.json"], err)
+	}
+	if items[1].ProfitLossID != tenantRowID || items[1].Category != "Sewa" || items[1].Note != "Maret" {
+		t.Errorf("items[1] = %+v", items[1])
+	}
+	if !bytes.Contains(files["profit_loss_items.csv"], []byte("2,7,10,2025-03-01,4,Sewa,expense,200,Maret")) {
+		t.Errorf("profit_loss_items.csv:\n%s", files["profit_loss_items.csv"])
+	}
+	var categories []exportedCategory
+	if err := json.Unmarshal(files["categories.json"], &categories); err != nil || len(categories) != 2 || categories[0].OrganizationID != tenantOrgA {
+		t.Fatalf("categories.json = %s (%v)", files["categories.json"], err)
+	}
+}
+
+// Purge: data organisasi pribadi dihapus, data di organisasi bersama dilepas dari user (user_id = 0)
+func TestPurgeAccountKeepsSharedOrganizationData(t *testing.T) {
+	mock := newMockDB(t)
+
+	mock.ExpectQuery(q("SELECT m.organization_id")).
+		WithArgs(tenantUserA, orgRoleOwner, orgRoleOwner).
+		WillReturnRows(sqlmock.NewRows([]string{"organization_id"}))
+	mock.ExpectBegin()
+	for i := 0; i < 7; i++ { // organisasi pribadi
+		mock.ExpectExec(q("IN (SELECT organization_id FROM")).
+			WithArgs(tenantUserA).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(q("UPDATE profit_losses SET user_id = 0 WHERE user_id = ?")).
+		WithArgs(tenantUserA).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(q("UPDATE tickets SET user_id = 0 WHERE user_id = ?")).
+		WithArgs(tenantUserA).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for i := 0; i < 13; i++ { // baris milik user sendiri
+		mock.ExpectExec(`^DELETE FROM \w+ WHERE (user_id|id|to_address|email) = `).
+			WithArgs(tenantUserA).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	if err := purgeAccount(tenantUserA); err != nil {
+		t.Fatal(err)
+	}
+}
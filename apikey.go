@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Scope API key (api_keys.scopes, dipisah koma)
+const (
+	scopeProfitLossRead  = "profitloss:read"
+	scopeProfitLossWrite = "profitloss:write"
+	scopeTickets         = "tickets"
+)
+
+// semua API key diawali prefix ini supaya bisa dibedakan dari access token
+const apiKeyPrefix = "plk_"
+
+// key untuk c.Locals
+const localsAPIKey = "apiKey"
+
+// permission route -> scope yang dibutuhkan kalau request pakai API key
+var permissionScopes = map[string]string{
+	permProfitLossRead:  scopeProfitLossRead,
+	permProfitLossWrite: scopeProfitLossWrite,
+	permTicketRead:      scopeTickets,
+	permTicketWrite:     scopeTickets,
+}
+
+var validScopes = map[string]bool{
+	scopeProfitLossRead:  true,
+	scopeProfitLossWrite: true,
+	scopeTickets:         true,
+}
+
+type APIKey struct {
+	ID             int      `json:"id"`
+	Name           string   `json:"name"`
+	Prefix         string   `json:"prefix"`
+	Scopes         []string `json:"scopes"`
+	OrganizationID int      `json:"organization_id"`
+	LastUsedAt     string   `json:"last_used_at"`
+	CreatedAt      string   `json:"created_at"`
+	RevokedAt      string   `json:"revoked_at"`
+}
+
+// API key hasil autentikasi (disimpan di c.Locals)
+type authAPIKey struct {
+	id     int
+	userID int
+	orgID  int
+	scopes map[string]bool
+}
+
+// =======================================
+// MIDDLEWARE: access token atau API key
+// =======================================
+// Dipakai di route data. "Authorization: Bearer plk_..." dicek sebagai API key,
+// request lama (user_id + app_key di body) dicek sebagai key legacy,
+// selain itu diteruskan ke authRequired.
+func authRequiredOrAPIKey(c *fiber.Ctx) error {
+	raw, _ := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		legacy, ok := legacyAppKey(c)
+		if !ok {
+			return authRequired(c)
+		}
+		// sementara, sampai integrasi lama pindah ke key plk_
+		raw = legacy
+		c.Set("Deprecation", "true")
+	}
+
+	key, err := lookupAPIKey(raw)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or revoked api key"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Locals(localsUserID, key.userID)
+	c.Locals(localsAPIKey, key)
+	return c.Next()
+}
+
+// =======================================
+// MIDDLEWARE: wajib API key
+// =======================================
+// untuk endpoint integrasi (POS / software akuntansi), access token tidak diterima
+func apiKeyRequired(c *fiber.Ctx) error {
+	raw, _ := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return c.Status(401).JSON(fiber.Map{"error": "api key required"})
+	}
+	return authRequiredOrAPIKey(c)
+}
+
+// app_key lama: POST dengan user_id + app_key di body JSON, tanpa header Authorization.
+// Dicocokkan ke api_keys lewat hash "<user_id>:<app_key>" (sama dengan migrasi 0011).
+func legacyAppKey(c *fiber.Ctx) (string, bool) {
+	if c.Method() != fiber.MethodPost || c.Get(fiber.HeaderAuthorization) != "" {
+		return "", false
+	}
+	var body struct {
+		UserID int    `json:"user_id"`
+		AppKey string `json:"app_key"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil || body.UserID == 0 || body.AppKey == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%s", body.UserID, body.AppKey), true
+}
+
+func lookupAPIKey(raw string) (*authAPIKey, error) {
+	var (
+		key    authAPIKey
+		scopes string
+	)
+	err := db.QueryRow(`
+		SELECT k.id, k.user_id, k.organization_id, k.scopes
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND k.revoked_at IS NULL AND u.is_active = 1
+	`, hashToken(raw)).Scan(&key.id, &key.userID, &key.orgID, &scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	key.scopes = map[string]bool{}
+	for _, s := range strings.Split(scopes, ",") {
+		key.scopes[s] = true
+	}
+
+	// last_used_at cukup per menit, supaya tidak update di setiap request
+	now := time.Now()
+	_, err = db.Exec(
+		"UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now, key.id, now.Add(-time.Minute),
+	)
+	return &key, err
+}
+
+// helper ambil API key hasil authRequiredOrAPIKey (nil kalau pakai access token)
+func currentAPIKey(c *fiber.Ctx) *authAPIKey {
+	key, _ := c.Locals(localsAPIKey).(*authAPIKey)
+	return key
+}
+
+// =======================================
+// LIST API key milik user
+// =======================================
+func getAPIKeys(c *fiber.Ctx) error {
+	rows, err := db.Query(`
+		SELECT id, name, prefix, scopes, organization_id,
+			COALESCE(last_used_at, ''), created_at, COALESCE(revoked_at, '')
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY id DESC
+	`, currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var (
+			k      APIKey
+			scopes string
+		)
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.OrganizationID,
+			&k.LastUsedAt, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		k.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, k)
+	}
+	return c.JSON(keys)
+}
+
+// =======================================
+// CREATE API key (untuk organisasi aktif)
+// =======================================
+// Key mentah hanya dikembalikan sekali di response ini.
+func createAPIKey(c *fiber.Ctx) error {
+	req := new(struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	})
+	if err := c.BodyParser(req); err != nil || strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			return c.Status(400).JSON(fiber.Map{"error": "unknown scope", "scope": s})
+		}
+	}
+
+	raw, err := generateAPIKey()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	res, err := db.Exec(`
+		INSERT INTO api_keys (user_id, organization_id, name, prefix, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, currentUserID(c), currentOrgID(c), name, apiKeyDisplayPrefix(raw), hashToken(raw),
+		strings.Join(req.Scopes, ","), time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	id, _ := res.LastInsertId()
+
+	return c.JSON(fiber.Map{
+		"message":         "api key created",
+		"id":              id,
+		"name":            name,
+		"key":             raw,
+		"scopes":          req.Scopes,
+		"organization_id": currentOrgID(c),
+	})
+}
+
+// =======================================
+// ROTATE API key (key lama langsung tidak berlaku)
+// =======================================
+func rotateAPIKey(c *fiber.Ctx) error {
+	raw, err := generateAPIKey()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	err = execOwned(`
+		UPDATE api_keys SET prefix = ?, key_hash = ?, last_used_at = NULL
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`, apiKeyDisplayPrefix(raw), hashToken(raw), c.Params("id"), currentUserID(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "api key rotated", "id": atoi(c.Params("id")), "key": raw})
+}
+
+// =======================================
+// REVOKE API key
+// =======================================
+func revokeAPIKey(c *fiber.Ctx) error {
+	err := execOwned(
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), c.Params("id"), currentUserID(c),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "api key revoked"})
+}
+
+// =======================================
+// HELPER
+// =======================================
+func generateAPIKey() (string, error) {
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + secret, nil
+}
+
+// potongan awal key untuk ditampilkan di list (bukan rahasia)
+func apiKeyDisplayPrefix(raw string) string {
+	return raw[:len(apiKeyPrefix)+8]
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+// klien lama: user_id + app_key di body, tanpa header Authorization (key legacy dari migrasi 0011)
+func TestAuthRequiredOrAPIKeyLegacyAppKey(t *testing.T) {
+	mock := newMockDB(t)
+	mock.ExpectQuery(q("FROM api_keys k")).
+		WithArgs(hashToken("1:Ab3dE6gH")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "scopes"}).
+			AddRow(9, tenantUserA, tenantOrgA, "profitloss:write,tickets"))
+	mock.ExpectExec(q("UPDATE api_keys SET last_used_at = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	app.Post("/api/ticket", authRequiredOrAPIKey, func(c *fiber.Ctx) error {
+		key := currentAPIKey(c)
+		if key == nil || currentUserID(c) != tenantUserA || key.orgID != tenantOrgA || !key.scopes[scopeTickets] {
+			return c.Status(500).JSON(fiber.Map{"error": "unexpected auth locals"})
+		}
+		return c.SendStatus(200)
+	})
+
+	resp, body := doRequest(t, app, "POST", "/api/ticket", `{"user_id":1,"app_key":"Ab3dE6gH","description":"printer rusak"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Deprecation") != "true" {
+		t.Error("missing Deprecation header on legacy app_key request")
+	}
+
+	// app_key salah -> 401, tanpa jatuh ke access token
+	mock.ExpectQuery(q("FROM api_keys k")).
+		WithArgs(hashToken("1:salah")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "scopes"}))
+	resp, body = doRequest(t, app, "POST", "/api/ticket", `{"user_id":1,"app_key":"salah"}`)
+	if resp.StatusCode != 401 {
+		t.Fatalf("wrong app_key: status %d body %s", resp.StatusCode, body)
+	}
+}
@@ -6,8 +6,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"math/big"
-	"net/smtp"
+	"net/url"
 	"os"
 	"time"
 
@@ -15,6 +14,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// masa berlaku link verifikasi email
+const verificationTokenTTL = 48 * time.Hour
+
 // =======================================
 // LOGIN PROCESS
 // =======================================
@@ -24,27 +26,36 @@ func loginProcess(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
 
+	// Cek brute-force (per IP & per akun)
+	wait, err := loginRetryAfter(c, req.Email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if wait > 0 {
+		return tooManyLoginAttempts(c, wait)
+	}
+
 	var (
-		user             User
-		hashedPassword   string
-		isActive         bool
-		accessToProduct1 bool
+		user           User
+		hashedPassword string
+		isActive       bool
 	)
 
-	// Ambil user berdasarkan email (tambahkan app_key)
-	err := db.QueryRow(`
-		SELECT id, role_id, name, email, password, is_active, access_to_product_1, organization, whatsapp, app_key
+	// Ambil user berdasarkan email
+	err = db.QueryRow(`
+		SELECT id, role_id, name, email, password, is_active, organization, whatsapp, locale
 		FROM users 
 		WHERE email = ?
 		LIMIT 1
 	`, req.Email).Scan(
 		&user.ID, &user.RoleID, &user.Name, &user.Email,
-		&hashedPassword, &isActive, &accessToProduct1,
-		&user.Organization, &user.Whatsapp, &user.AppKey,
+		&hashedPassword, &isActive,
+		&user.Organization, &user.Whatsapp, &user.Locale,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
+			recordLoginFailure(c, req.Email, 0)
 			return c.Status(401).JSON(fiber.Map{"error": "invalid credentials"})
 		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -55,21 +66,69 @@ func loginProcess(c *fiber.Ctx) error {
 		return c.Status(403).JSON(fiber.Map{"error": "user not active"})
 	}
 
-	// Cek apakah user punya akses ke produk 1
-	if !accessToProduct1 {
+	// Cek apakah user punya entitlement aktif ke produk ini
+	user.AccessToProduct1, err = hasEntitlement(user.ID, productProfitLoss)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !user.AccessToProduct1 {
 		return c.Status(403).JSON(fiber.Map{"error": "user does not have access to this system"})
 	}
 
 	// Cek password bcrypt
 	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+		recordLoginFailure(c, req.Email, user.ID)
 		return c.Status(401).JSON(fiber.Map{"error": "invalid credentials"})
 	}
+	recordLoginSuccess(c, req.Email)
+
+	// Kalau 2FA aktif, token baru diberikan setelah langkah kode (/api/login/2fa)
+	enabled, err := twoFactorEnabled(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if enabled {
+		challenge, err := createUserToken(db, user.ID, purposeLogin2FA, twoFactorTokenTTL)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+		}
+		return c.JSON(fiber.Map{
+			"message":             "two-factor authentication required",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+	}
+
+	// Bikin access token + refresh token
+	session, err := issueSession(c, db, user.ID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
 
 	// Login sukses
-	return c.JSON(fiber.Map{
-		"message": "login success",
-		"user":    user,
-	})
+	session["message"] = "login success"
+	session["user"] = user
+	return c.JSON(session)
+}
+
+// =======================================
+// HELPER: Get User By ID
+// =======================================
+func getUserByID(id int) (User, error) {
+	var user User
+	err := db.QueryRow(`
+		SELECT id, role_id, name, email, organization, whatsapp, locale
+		FROM users
+		WHERE id = ?
+	`, id).Scan(
+		&user.ID, &user.RoleID, &user.Name, &user.Email,
+		&user.Organization, &user.Whatsapp, &user.Locale,
+	)
+	if err != nil {
+		return user, err
+	}
+	user.AccessToProduct1, err = hasEntitlement(user.ID, productProfitLoss)
+	return user, err
 }
 
 // =======================================
@@ -82,6 +141,7 @@ func registerProcess(c *fiber.Ctx) error {
 		Email        string `json:"email"`
 		Whatsapp     string `json:"whatsapp"`
 		Password     string `json:"password"`
+		Locale       string `json:"locale"`
 	}
 
 	req := new(RegisterRequest)
@@ -89,6 +149,10 @@ func registerProcess(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
 
+	if violations := validatePassword(req.Password, req.Email, req.Name); len(violations) > 0 {
+		return passwordPolicyError(c, violations)
+	}
+
 	// cek email sudah ada atau belum
 	var existing int
 	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", req.Email).Scan(&existing)
@@ -105,16 +169,21 @@ func registerProcess(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
 	}
 
-	// generate app_key
-	appKey := generateRandomString(8)
+	locale := normalizeLocale(req.Locale)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
 
 	// insert user baru (email_verified_at = NULL)
-	result, err := db.Exec(`
-		INSERT INTO users (role_id, name, email, password, is_active, organization, whatsapp, app_key, email_verified_at, access_to_product_1)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL, 1)
+	result, err := tx.Exec(`
+		INSERT INTO users (role_id, name, email, password, is_active, organization, whatsapp, email_verified_at, access_to_product_1, locale)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULL, 1, ?)
 	`,
-		3, req.Name, req.Email, string(hashedPassword),
-		0, req.Organization, req.Whatsapp, appKey,
+		roleMember, req.Name, req.Email, string(hashedPassword),
+		0, req.Organization, req.Whatsapp, locale,
 	)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -122,28 +191,52 @@ func registerProcess(c *fiber.Ctx) error {
 
 	lastID, _ := result.LastInsertId()
 
-	// bikin token verifikasi
-	token := generateVerificationToken(req.Email, appKey)
+	// setiap user baru punya organisasi sendiri (dia owner)
+	orgName := req.Organization
+	if orgName == "" {
+		orgName = req.Name
+	}
+	orgID, err := createOrganization(tx, orgName, int(lastID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	// bikin link verifikasi
-	// verificationLink := fmt.Sprintf("http://147.139.177.186:3378/api/verify?email=%s&token=%s", req.Email, token)
-	apiURL := os.Getenv("VPS_APP_URL")
-	verificationLink := fmt.Sprintf("%sapi/verify?email=%s&token=%s", apiURL, req.Email, token)
+	// akses ke produk ini lewat entitlement (kolom access_to_product_1 hanya legacy)
+	if _, err := grantEntitlement(tx, int(lastID), productProfitLoss, time.Now(), nil, 0); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 
-	// kirim email (async)
-	go sendVerificationEmail(req.Email, verificationLink)
+	// bikin token verifikasi (disimpan hash-nya)
+	token, err := createUserToken(tx, int(lastID), purposeVerifyEmail, verificationTokenTTL)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// email verifikasi masuk outbox di transaksi yang sama, dikirim worker
+	msg, err := verificationEmail(req.Email, req.Name, locale, verificationLink(req.Email, token))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "register success, please check your email to verify account",
 		"user": fiber.Map{
-			"id":           lastID,
-			"role_id":      3,
-			"name":         req.Name,
-			"email":        req.Email,
-			"organization": req.Organization,
-			"whatsapp":     req.Whatsapp,
-			"app_key":      appKey,
-			"is_active":    1,
+			"id":              lastID,
+			"role_id":         roleMember,
+			"name":            req.Name,
+			"email":           req.Email,
+			"organization":    req.Organization,
+			"organization_id": orgID,
+			"whatsapp":        req.Whatsapp,
+			"locale":          locale,
+			"is_active":       1,
 		},
 	})
 }
@@ -153,7 +246,6 @@ func registerProcess(c *fiber.Ctx) error {
 // =======================================
 func changePasswordProcess(c *fiber.Ctx) error {
 	type ChangePasswordRequest struct {
-		UserID          int    `json:"user_id"`
 		CurrentPassword string `json:"currentPassword"`
 		NewPassword     string `json:"newPassword"`
 	}
@@ -163,9 +255,11 @@ func changePasswordProcess(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
 
+	userID := currentUserID(c)
+
 	// Ambil password lama dari DB
-	var hashedPassword string
-	err := db.QueryRow("SELECT password FROM users WHERE id = ?", req.UserID).Scan(&hashedPassword)
+	var hashedPassword, email, name string
+	err := db.QueryRow("SELECT password, email, name FROM users WHERE id = ?", userID).Scan(&hashedPassword, &email, &name)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
@@ -178,68 +272,82 @@ func changePasswordProcess(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "current password is incorrect"})
 	}
 
+	if violations := validatePassword(req.NewPassword, email, name); len(violations) > 0 {
+		return passwordPolicyError(c, violations)
+	}
+
 	// Hash password baru
 	newHashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "failed to hash new password"})
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
 	// Update ke DB
-	_, err = db.Exec("UPDATE users SET password = ? WHERE id = ?", string(newHashed), req.UserID)
+	_, err = tx.Exec("UPDATE users SET password = ? WHERE id = ?", string(newHashed), userID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(fiber.Map{"message": "password updated successfully"})
+	// Sesi lain (mungkin milik orang yang tahu password lama) diakhiri;
+	// pemanggil langsung dapat sesi baru supaya tidak perlu login ulang
+	if err := revokeAllSessions(tx, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	session, err := issueSession(c, tx, userID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	session["message"] = "password updated successfully"
+	return c.JSON(session)
 }
 
 // =======================================
-// Helper: Generate Random String
+// Helper: Generate Secure Token (hex)
 // =======================================
-func generateRandomString(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	bytes := make([]byte, n)
-	for i := range bytes {
-		num, _ := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
-		bytes[i] = letters[num.Int64()]
-	}
-	return string(bytes)
+func generateSecureToken(nBytes int) (string, error) {
+	buf := make([]byte, nBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
 
 // =======================================
-// HELPER: Generate Verification Token
+// Helper: Hash Token (yang disimpan di DB hanya hash-nya)
 // =======================================
-func generateVerificationToken(email, appKey string) string {
-	data := fmt.Sprintf("%s:%s:%d", email, appKey, time.Now().Unix())
-	hash := sha256.Sum256([]byte(data))
+func hashToken(raw string) string {
+	hash := sha256.Sum256([]byte(raw))
 	return hex.EncodeToString(hash[:])
 }
 
 // =======================================
-// HELPER: Send Verification Email
+// HELPER: Verification Link
 // =======================================
-func sendVerificationEmail(to string, link string) error {
-	from := "optimateknologiindustri@gmail.com"
-	password := "gzew ksdw kdef bcex" // ⚠️ ini App Password, bukan password Gmail biasa
-
-	// Gmail SMTP server
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	// Auth
-	auth := smtp.PlainAuth("", from, password, smtpHost)
-
-	// Pesan email
-	subject := "Subject: Verify your email\n"
-	body := fmt.Sprintf("Halo,\n\nSilakan klik link berikut untuk verifikasi email Anda:\n%s\n\nTerima kasih.", link)
-	msg := []byte(subject + "\n" + body)
+func verificationLink(email, token string) string {
+	// verificationLink := fmt.Sprintf("http://147.139.177.186:3378/api/verify?email=%s&token=%s", email, token)
+	apiURL := os.Getenv("VPS_APP_URL")
+	return fmt.Sprintf("%sapi/verify?email=%s&token=%s", apiURL, url.QueryEscape(email), token)
+}
 
-	// Kirim
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{to}, msg)
-	if err != nil {
-		return err
-	}
-	return nil
+// =======================================
+// HELPER: Verification Email
+// =======================================
+func verificationEmail(to, name, locale, link string) (Message, error) {
+	return renderEmail("verify_email", locale, to, map[string]any{
+		"Name": name,
+		"Link": link,
+	})
 }
 
 // =======================================
@@ -253,19 +361,104 @@ func verifyEmailHandler(c *fiber.Ctx) error {
 		return c.Status(400).SendString("Invalid verification link")
 	}
 
-	// (opsional) validasi token
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).SendString("Failed to verify email")
+	}
+	defer tx.Rollback()
 
-	// update email_verified_at + aktifkan user
-	_, err := db.Exec(
-		"UPDATE users SET email_verified_at = ?, is_active = 1 WHERE email = ?",
-		time.Now(), email,
+	// validasi token (sekali pakai + belum kadaluarsa)
+	userID, err := consumeUserToken(tx, purposeVerifyEmail, token)
+	if err != nil {
+		if err == errUserTokenInvalid {
+			return c.Status(400).SendString("Invalid or expired verification link")
+		}
+		return c.Status(500).SendString("Failed to verify email")
+	}
+
+	// update email_verified_at + aktifkan user (email harus cocok dengan pemilik token)
+	err = execOwnedTx(tx,
+		"UPDATE users SET email_verified_at = ?, is_active = 1 WHERE id = ? AND email = ?",
+		time.Now(), userID, email,
 	)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(400).SendString("Invalid or expired verification link")
+		}
+		return c.Status(500).SendString("Failed to verify email")
+	}
+
+	if err := tx.Commit(); err != nil {
 		return c.Status(500).SendString("Failed to verify email")
 	}
 
 	// redirect ke halaman tujuan
 	// return c.Redirect("http://147.139.177.186:4498/", fiber.StatusSeeOther)
-	return c.Redirect("https://dashboard-laba-rugi.vercel.app/", fiber.StatusSeeOther)
+	return c.Redirect(frontendURL(), fiber.StatusSeeOther)
+
+}
+
+// =======================================
+// RESEND VERIFICATION EMAIL
+// =======================================
+func resendVerificationProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Email string `json:"email"`
+	})
+	if err := c.BodyParser(req); err != nil || req.Email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	// response sama untuk email terdaftar/tidak, supaya tidak bisa dipakai cek email
+	okResponse := fiber.Map{"message": "if the account exists and is not verified yet, a new verification email has been sent"}
+
+	var (
+		userID int
+		name   string
+		locale string
+	)
+	err := db.QueryRow(
+		"SELECT id, name, locale FROM users WHERE email = ? AND email_verified_at IS NULL LIMIT 1",
+		req.Email,
+	).Scan(&userID, &name, &locale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(okResponse)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	throttled, err := userTokenThrottled(userID, purposeVerifyEmail, time.Minute, 5)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if throttled {
+		c.Set(fiber.HeaderRetryAfter, "60")
+		return c.Status(429).JSON(fiber.Map{"error": "too many requests, please wait before requesting another email"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	token, err := createUserToken(tx, userID, purposeVerifyEmail, verificationTokenTTL)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	msg, err := verificationEmail(req.Email, name, locale, verificationLink(req.Email, token))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 
+	return c.JSON(okResponse)
 }
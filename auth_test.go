@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// argumen sqlmock yang menyimpan nilai yang dikirim handler, supaya bisa dipakai di langkah berikutnya
+type captureArg struct {
+	value string
+}
+
+func (a *captureArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if ok {
+		a.value = s
+	}
+	return ok
+}
+
+// Register -> email verifikasi lewat outbox -> buka link -> akun aktif
+func TestRegisterSendsVerificationEmail(t *testing.T) {
+	t.Setenv("VPS_APP_URL", "https://api.example.test/")
+	mock := newMockDB(t)
+
+	prevMailer := mailer
+	mem := &memoryMailer{}
+	mailer = mem
+	t.Cleanup(func() { mailer = prevMailer })
+
+	const (
+		email  = "budi@example.com"
+		userID = 5
+	)
+	var (
+		tokenHash               = &captureArg{}
+		to, subject, text, html = &captureArg{}, &captureArg{}, &captureArg{}, &captureArg{}
+		verifyLink              = regexp.MustCompile(`https://api\.example\.test/api/verify\?\S+`)
+	)
+
+	// ===== register =====
+	mock.ExpectQuery(q("SELECT COUNT(*) FROM users WHERE email = ?")).
+		WithArgs(email).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec(q("INSERT INTO users")).WillReturnResult(sqlmock.NewResult(userID, 1))
+	mock.ExpectExec(q("INSERT INTO organizations")).WillReturnResult(sqlmock.NewResult(50, 1))
+	mock.ExpectExec(q("INSERT INTO organization_members")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("INSERT INTO user_product_entitlements")).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(q("INSERT INTO user_tokens")).
+		WithArgs(userID, purposeVerifyEmail, tokenHash, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("INSERT INTO email_outbox")).
+		WithArgs(to, subject, text, html, outboxPending, outboxMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/register", registerProcess)
+	app.Get("/api/verify", verifyEmailHandler)
+
+	resp, body := doRequest(t, app, "POST", "/api/register",
+		`{"name":"Budi","email":"`+email+`","password":"rahasia-kuat-123","organization":"Toko Budi"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("register: status %d body %s", resp.StatusCode, body)
+	}
+
+	// ===== worker outbox mengirim email =====
+	mock.ExpectExec(q("UPDATE email_outbox SET status = ?, updated_at = ? WHERE id = ? AND status = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(q("FROM email_outbox WHERE id = ?")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"to_address", "subject", "body_text", "body_html", "attempts", "max_attempts"}).
+			AddRow(to.value, subject.value, text.value, html.value, 0, outboxMaxAttempts))
+	mock.ExpectExec(q("UPDATE email_outbox SET status = ?, attempts = ?, sent_at = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := deliverOutboxEmail(1); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := mem.Messages()
+	if len(sent) != 1 || sent[0].To != email {
+		t.Fatalf("sent = %+v, want 1 message to %s", sent, email)
+	}
+	link := verifyLink.FindString(sent[0].Text)
+	if link == "" {
+		t.Fatalf("no verification link in email:\n%s", sent[0].Text)
+	}
+
+	// ===== buka link verifikasi =====
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("email") != email || hashToken(u.Query().Get("token")) != tokenHash.value {
+		t.Fatalf("link %s does not carry the stored token", link)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(q("FROM user_tokens")).
+		WithArgs(sqlmock.AnyArg(), tokenHash.value, purposeVerifyEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "data", "used_at", "expired"}).
+			AddRow(1, userID, "", nil, false))
+	mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("UPDATE users SET email_verified_at = ?, is_active = 1 WHERE id = ? AND email = ?")).
+		WithArgs(sqlmock.AnyArg(), userID, email).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, body = doRequest(t, app, "GET", strings.TrimPrefix(link, "https://api.example.test"), "")
+	if resp.StatusCode != 303 {
+		t.Fatalf("verify: status %d body %s", resp.StatusCode, body)
+	}
+}
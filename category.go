@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Jenis kategori (categories.type)
+const (
+	categoryIncome  = "income"  // masuk ke revenue
+	categoryExpense = "expense" // masuk ke expense
+)
+
+var errInvalidCategory = errors.New("unknown category")
+
+type Category struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// rincian pendapatan / beban satu hari per kategori
+type ProfitLossItem struct {
+	ID         int     `json:"id"`
+	CategoryID int     `json:"category_id"`
+	Category   string  `json:"category,omitempty"`
+	Type       string  `json:"type,omitempty"`
+	Amount     float64 `json:"amount"`
+	Note       string  `json:"note"`
+}
+
+type CategoryBreakdown struct {
+	CategoryID int                `json:"category_id"`
+	Name       string             `json:"name"`
+	Type       string             `json:"type"`
+	Total      float64            `json:"total"`
+	Share      float64            `json:"share"` // % dari total revenue/expense item sejenis
+	Monthly    map[string]float64 `json:"monthly"`
+}
+
+func validCategoryType(t string) bool {
+	return t == categoryIncome || t == categoryExpense
+}
+
+// =======================================
+// LIST kategori organisasi aktif
+// =======================================
+func getCategories(c *fiber.Ctx) error {
+	rows, err := db.Query(
+		"SELECT id, name, type FROM categories WHERE organization_id = ? ORDER BY type, name",
+		currentOrgID(c),
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var cat Category
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Type); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		categories = append(categories, cat)
+	}
+	return c.JSON(categories)
+}
+
+// =======================================
+// CREATE kategori
+// =======================================
+func createCategory(c *fiber.Ctx) error {
+	cat := new(Category)
+	if err := c.BodyParser(cat); err != nil || strings.TrimSpace(cat.Name) == "" || !validCategoryType(cat.Type) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	cat.Name = strings.TrimSpace(cat.Name)
+	orgID := currentOrgID(c)
+
+	var exists int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM categories WHERE organization_id = ? AND type = ? AND name = ?",
+		orgID, cat.Type, cat.Name,
+	).Scan(&exists)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if exists > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "category already exists"})
+	}
+
+	res, err := db.Exec(
+		"INSERT INTO categories (organization_id, name, type, created_at) VALUES (?, ?, ?, ?)",
+		orgID, cat.Name, cat.Type, time.Now(),
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	id, _ := res.LastInsertId()
+	cat.ID = int(id)
+	return c.JSON(cat)
+}
+
+// =======================================
+// UPDATE kategori (hanya nama; jenis tetap supaya roll-up lama tidak berubah)
+// =======================================
+func updateCategory(c *fiber.Ctx) error {
+	req := new(struct {
+		Name string `json:"name"`
+	})
+	if err := c.BodyParser(req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	err := execOwned(
+		"UPDATE categories SET name = ? WHERE id = ? AND organization_id = ?",
+		strings.TrimSpace(req.Name), c.Params("id"), currentOrgID(c),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateStats(currentOrgID(c)) // nama kategori ikut di categoryStats
+	return c.JSON(fiber.Map{"message": "category updated", "id": atoi(c.Params("id")), "name": strings.TrimSpace(req.Name)})
+}
+
+// =======================================
+// DELETE kategori (hanya kalau belum dipakai)
+// =======================================
+func deleteCategory(c *fiber.Ctx) error {
+	// hanya item di organisasi aktif, supaya tidak bisa dipakai cek kategori organisasi lain
+	var used int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM profit_loss_items i
+		JOIN profit_losses pl ON pl.id = i.profit_loss_id
+		WHERE i.category_id = ? AND pl.organization_id = ?
+	`, c.Params("id"), currentOrgID(c)).Scan(&used)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if used > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "category is used by line items"})
+	}
+
+	err = execOwned("DELETE FROM categories WHERE id = ? AND organization_id = ?", c.Params("id"), currentOrgID(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "deleted"})
+}
+
+// =======================================
+// HELPER: line item
+// =======================================
+
+// validasi kategori item (harus milik organisasi) + hitung total revenue/expense
+func rollupItems(orgID int, items []ProfitLossItem) (revenue, expense float64, err error) {
+	types := map[int]string{}
+	rows, err := db.Query("SELECT id, type FROM categories WHERE organization_id = ?", orgID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id  int
+			typ string
+		)
+		if err := rows.Scan(&id, &typ); err != nil {
+			return 0, 0, err
+		}
+		types[id] = typ
+	}
+
+	for i := range items {
+		if items[i].Amount < 0 {
+			return 0, 0, fmt.Errorf("item %d: amount must not be negative", i)
+		}
+		switch types[items[i].CategoryID] {
+		case categoryIncome:
+			revenue += items[i].Amount
+		case categoryExpense:
+			expense += items[i].Amount
+		default:
+			return 0, 0, fmt.Errorf("item %d: %w", i, errInvalidCategory)
+		}
+		items[i].Type = types[items[i].CategoryID]
+	}
+	return revenue, expense, nil
+}
+
+// ganti semua item satu baris profit_losses
+func replaceProfitLossItems(ex execer, profitLossID int, items []ProfitLossItem) error {
+	if _, err := ex.Exec("DELETE FROM profit_loss_items WHERE profit_loss_id = ?", profitLossID); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range items {
+		res, err := ex.Exec(
+			"INSERT INTO profit_loss_items (profit_loss_id, category_id, amount, note, created_at) VALUES (?, ?, ?, ?, ?)",
+			profitLossID, items[i].CategoryID, items[i].Amount, items[i].Note, now,
+		)
+		if err != nil {
+			return err
+		}
+		id, _ := res.LastInsertId()
+		items[i].ID = int(id)
+	}
+	return nil
+}
+
+func getProfitLossItems(profitLossID int) ([]ProfitLossItem, error) {
+	rows, err := db.Query(`
+		SELECT i.id, i.category_id, c.name, c.type, i.amount, i.note
+		FROM profit_loss_items i
+		JOIN categories c ON c.id = i.category_id
+		WHERE i.profit_loss_id = ?
+		ORDER BY c.type DESC, i.id
+	`, profitLossID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ProfitLossItem{}
+	for rows.Next() {
+		var it ProfitLossItem
+		if err := rows.Scan(&it.ID, &it.CategoryID, &it.Category, &it.Type, &it.Amount, &it.Note); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// =======================================
+// HELPER: breakdown per kategori untuk stats
+// =======================================
+// months = label bulan ("January 2006") yang diisi nol kalau kosong
+func categoryBreakdown(orgID int, from, to time.Time, months []string) ([]CategoryBreakdown, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.type, DATE_FORMAT(pl.date, '%Y-%m-01'), SUM(i.amount)
+		FROM profit_loss_items i
+		JOIN profit_losses pl ON pl.id = i.profit_loss_id
+		JOIN categories c ON c.id = i.category_id
+		WHERE pl.organization_id = ? AND pl.date BETWEEN ? AND ?
+		GROUP BY c.id, c.name, c.type, DATE_FORMAT(pl.date, '%Y-%m-01')
+		ORDER BY c.type DESC, c.name
+	`, orgID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := []CategoryBreakdown{}
+	index := map[int]int{}
+	typeTotals := map[string]float64{}
+	for rows.Next() {
+		var (
+			id        int
+			name, typ string
+			month     string
+			amount    float64
+		)
+		if err := rows.Scan(&id, &name, &typ, &month, &amount); err != nil {
+			return nil, err
+		}
+		i, ok := index[id]
+		if !ok {
+			monthly := make(map[string]float64, len(months))
+			for _, m := range months {
+				monthly[m] = 0
+			}
+			breakdown = append(breakdown, CategoryBreakdown{CategoryID: id, Name: name, Type: typ, Monthly: monthly})
+			i = len(breakdown) - 1
+			index[id] = i
+		}
+		if t, err := time.Parse("2006-01-02", month); err == nil {
+			breakdown[i].Monthly[t.Format("January 2006")] += amount
+		}
+		breakdown[i].Total += amount
+		typeTotals[typ] += amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range breakdown {
+		if total := typeTotals[breakdown[i].Type]; total > 0 {
+			breakdown[i].Share = breakdown[i].Total / total * 100
+		}
+	}
+	return breakdown, nil
+}
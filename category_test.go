@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// kategori id 7 milik organisasi A dan dipakai item di sana; hapus dari organisasi B harus 404, bukan 400
+func TestDeleteCategoryCrossTenant(t *testing.T) {
+	mock := newMockDB(t)
+	mock.ExpectQuery(q("WHERE i.category_id = ? AND pl.organization_id = ?")).
+		WithArgs("7", tenantOrgB).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(q("DELETE FROM categories WHERE id = ? AND organization_id = ?")).
+		WithArgs("7", tenantOrgB).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	app := newTestApp(tenantUserB, tenantOrgB, orgRoleOwner)
+	app.Delete("/api/profitloss/categories/:id", deleteCategory)
+	resp, body := doRequest(t, app, "DELETE", "/api/profitloss/categories/7", "")
+	if resp.StatusCode != 404 {
+		t.Fatalf("status = %d, want 404 (body %s)", resp.StatusCode, body)
+	}
+}
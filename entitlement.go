@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Produk yang dilayani backend ini (products.id)
+const productProfitLoss = 1
+
+type Product struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+type Entitlement struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	ProductID int    `json:"product_id"`
+	Product   string `json:"product"`
+	StartsAt  string `json:"starts_at"`
+	ExpiresAt string `json:"expires_at"`
+	RevokedAt string `json:"revoked_at"`
+	Active    bool   `json:"active"`
+}
+
+// =======================================
+// HELPER: cek entitlement aktif
+// =======================================
+func hasEntitlement(userID, productID int) (bool, error) {
+	now := time.Now()
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM user_product_entitlements
+		WHERE user_id = ? AND product_id = ?
+			AND revoked_at IS NULL
+			AND starts_at <= ?
+			AND (expires_at IS NULL OR expires_at > ?)
+	`, userID, productID, now, now).Scan(&count)
+	return count > 0, err
+}
+
+func grantEntitlement(ex execer, userID, productID int, startsAt time.Time, expiresAt *time.Time, grantedBy int) (int64, error) {
+	var by any
+	if grantedBy != 0 {
+		by = grantedBy
+	}
+	res, err := ex.Exec(`
+		INSERT INTO user_product_entitlements (user_id, product_id, starts_at, expires_at, granted_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, productID, startsAt, expiresAt, by, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// =======================================
+// MIDDLEWARE: wajib punya entitlement produk
+// =======================================
+// dipasang setelah authRequired
+func requireEntitlement(productID int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ok, err := hasEntitlement(currentUserID(c), productID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !ok {
+			return c.Status(403).JSON(fiber.Map{"error": "user does not have access to this product"})
+		}
+		return c.Next()
+	}
+}
+
+// =======================================
+// ADMIN: list produk
+// =======================================
+func getProducts(c *fiber.Ctx) error {
+	rows, err := db.Query("SELECT id, code, name FROM products ORDER BY id")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.ID, &p.Code, &p.Name); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		products = append(products, p)
+	}
+	return c.JSON(products)
+}
+
+// =======================================
+// ADMIN: list entitlement user
+// =======================================
+func getUserEntitlements(c *fiber.Ctx) error {
+	now := time.Now()
+	rows, err := db.Query(`
+		SELECT e.id, e.user_id, e.product_id, p.name, e.starts_at,
+			COALESCE(e.expires_at, ''), COALESCE(e.revoked_at, ''),
+			(e.revoked_at IS NULL AND e.starts_at <= ? AND (e.expires_at IS NULL OR e.expires_at > ?))
+		FROM user_product_entitlements e
+		JOIN products p ON p.id = e.product_id
+		WHERE e.user_id = ?
+		ORDER BY e.id DESC
+	`, now, now, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var entitlements []Entitlement
+	for rows.Next() {
+		var e Entitlement
+		if err := rows.Scan(&e.ID, &e.UserID, &e.ProductID, &e.Product, &e.StartsAt,
+			&e.ExpiresAt, &e.RevokedAt, &e.Active); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		entitlements = append(entitlements, e)
+	}
+	return c.JSON(entitlements)
+}
+
+// =======================================
+// ADMIN: grant entitlement
+// =======================================
+func createUserEntitlement(c *fiber.Ctx) error {
+	userID := atoi(c.Params("id"))
+	req := new(struct {
+		ProductID int    `json:"product_id"`
+		StartsAt  string `json:"starts_at"`  // kosong = sekarang
+		ExpiresAt string `json:"expires_at"` // kosong = tanpa batas
+	})
+	if err := c.BodyParser(req); err != nil || req.ProductID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	startsAt := time.Now()
+	if req.StartsAt != "" {
+		t, err := parseDateOrTime(req.StartsAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid starts_at"})
+		}
+		startsAt = t
+	}
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := parseDateOrTime(req.ExpiresAt)
+		if err != nil || !t.After(startsAt) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid expires_at"})
+		}
+		expiresAt = &t
+	}
+
+	var users, products int
+	err := db.QueryRow(
+		"SELECT (SELECT COUNT(*) FROM users WHERE id = ?), (SELECT COUNT(*) FROM products WHERE id = ?)",
+		userID, req.ProductID,
+	).Scan(&users, &products)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if users == 0 || products == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "user or product not found"})
+	}
+
+	id, err := grantEntitlement(db, userID, req.ProductID, startsAt, expiresAt, currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "entitlement granted", "id": id})
+}
+
+// =======================================
+// ADMIN: revoke entitlement
+// =======================================
+func revokeUserEntitlement(c *fiber.Ctx) error {
+	err := execOwned(
+		"UPDATE user_product_entitlements SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now(), c.Params("entitlementID"), c.Params("id"),
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "entitlement revoked"})
+}
+
+// helper parse "2006-01-02" atau RFC3339
+func parseDateOrTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// masa simpan response per Idempotency-Key (IDEMPOTENCY_TTL)
+var idempotencyTTL = 24 * time.Hour
+
+const maxIdempotencyKeyLen = 255
+
+// request pertama "memegang" key selama ini; kalau proses mati sebelum response
+// disimpan, setelah lease habis retry dengan request yang sama boleh mengambil alih
+const idempotencyLease = time.Minute
+
+// =======================================
+// MIDDLEWARE: Idempotency-Key
+// =======================================
+// Response pertama untuk (user, key) disimpan lalu diputar ulang untuk retry
+// dengan body yang sama. Key yang sama dengan body/route/organisasi lain ditolak 409.
+// Response 5xx tidak disimpan supaya request bisa dicoba lagi.
+func idempotent(c *fiber.Ctx) error {
+	key := c.Get("Idempotency-Key")
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		return c.Status(400).JSON(fiber.Map{"error": "Idempotency-Key too long"})
+	}
+
+	userID := currentUserID(c)
+	// organisasi aktif ikut di-hash: key yang sama di organisasi lain = request lain
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %s\norg:%d\n%s", c.Method(), c.Path(), currentOrgID(c), c.Body())))
+	requestHash := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	// key yang sudah lewat masa simpan boleh dipakai lagi
+	_, err := db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ? LIMIT 100", now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	res, err := db.Exec(`
+		INSERT IGNORE INTO idempotency_keys (user_id, idem_key, request_hash, status_code, locked_until, expires_at, created_at)
+		VALUES (?, ?, ?, 0, ?, ?, ?)
+	`, userID, key, requestHash, now.Add(idempotencyLease), now.Add(idempotencyTTL), now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// key sudah ada: ambil alih kalau masih status 0 dan lease-nya sudah habis (proses sebelumnya mati)
+		err := execOwned(`
+			UPDATE idempotency_keys SET locked_until = ?
+			WHERE user_id = ? AND idem_key = ? AND request_hash = ? AND status_code = 0
+				AND (locked_until IS NULL OR locked_until <= ?)
+		`, now.Add(idempotencyLease), userID, key, requestHash, now)
+		if err == sql.ErrNoRows {
+			return replayIdempotent(c, userID, key, requestHash)
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	if err := c.Next(); err != nil {
+		// kalau lease gagal dilepas, key baru bisa dipakai lagi setelah locked_until lewat
+		if _, delErr := db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ?", userID, key); delErr != nil {
+			log.Println("idempotency: release", key, ":", delErr)
+		}
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	if status >= 500 {
+		_, err = db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ?", userID, key)
+	} else {
+		_, err = db.Exec(
+			"UPDATE idempotency_keys SET status_code = ?, response_body = ? WHERE user_id = ? AND idem_key = ?",
+			status, c.Response().Body(), userID, key,
+		)
+	}
+	return err
+}
+
+func replayIdempotent(c *fiber.Ctx, userID int, key, requestHash string) error {
+	var (
+		storedHash string
+		status     int
+		body       []byte
+	)
+	err := db.QueryRow(`
+		SELECT request_hash, status_code, COALESCE(response_body, '')
+		FROM idempotency_keys
+		WHERE user_id = ? AND idem_key = ?
+	`, userID, key).Scan(&storedHash, &status, &body)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if storedHash != requestHash {
+		return c.Status(409).JSON(fiber.Map{"error": "Idempotency-Key already used with a different request"})
+	}
+	if status == 0 {
+		// request pertama masih diproses
+		return c.Status(409).JSON(fiber.Map{"error": "request with this Idempotency-Key is still in progress"})
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(status).Send(body)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+const idemBody = `{"description":"printer rusak"}`
+
+func newIdempotentApp(orgID int, calls *int) *fiber.App {
+	app := newTestApp(tenantUserA, orgID, orgRoleOwner)
+	app.Post("/api/ticket", idempotent, func(c *fiber.Ctx) error {
+		*calls++
+		return c.JSON(fiber.Map{"message": "ticket created"})
+	})
+	return app
+}
+
+// hash yang disimpan middleware untuk POST /api/ticket di organisasi orgID
+func idemHash(orgID int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("POST /api/ticket\norg:%d\n%s", orgID, idemBody)))
+	return hex.EncodeToString(sum[:])
+}
+
+// key sudah ada (INSERT IGNORE tidak menyisipkan baris)
+func expectExistingKey(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(q("DELETE FROM idempotency_keys WHERE expires_at <= ?")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(q("INSERT IGNORE INTO idempotency_keys")).
+		WithArgs(tenantUserA, "k1", idemHash(tenantOrgA), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestIdempotentLease(t *testing.T) {
+	t.Run("expired lease is reclaimed", func(t *testing.T) {
+		// request pertama mati setelah INSERT: status masih 0, lease sudah lewat
+		mock := newMockDB(t)
+		expectExistingKey(mock)
+		mock.ExpectExec(q("UPDATE idempotency_keys SET locked_until = ?")).
+			WithArgs(sqlmock.AnyArg(), tenantUserA, "k1", idemHash(tenantOrgA), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(q("UPDATE idempotency_keys SET status_code = ?, response_body = ?")).
+			WithArgs(200, sqlmock.AnyArg(), tenantUserA, "k1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var calls int
+		resp, body := doRequest(t, newIdempotentApp(tenantOrgA, &calls), "POST", "/api/ticket", idemBody, "Idempotency-Key", "k1")
+		if resp.StatusCode != 200 || calls != 1 {
+			t.Fatalf("status %d calls %d body %s", resp.StatusCode, calls, body)
+		}
+	})
+
+	t.Run("active lease stays in progress", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectExistingKey(mock)
+		mock.ExpectExec(q("UPDATE idempotency_keys SET locked_until = ?")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(q("FROM idempotency_keys")).
+			WithArgs(tenantUserA, "k1").
+			WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).AddRow(idemHash(tenantOrgA), 0, ""))
+
+		var calls int
+		resp, body := doRequest(t, newIdempotentApp(tenantOrgA, &calls), "POST", "/api/ticket", idemBody, "Idempotency-Key", "k1")
+		if resp.StatusCode != 409 || calls != 0 || !strings.Contains(body, "still in progress") {
+			t.Fatalf("status %d calls %d body %s", resp.StatusCode, calls, body)
+		}
+	})
+}
+
+func TestIdempotentKeyScopedToOrganization(t *testing.T) {
+	// key "k1" sudah dipakai user yang sama di organisasi B dengan body yang sama
+	mock := newMockDB(t)
+	expectExistingKey(mock)
+	mock.ExpectExec(q("UPDATE idempotency_keys SET locked_until = ?")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(q("FROM idempotency_keys")).
+		WithArgs(tenantUserA, "k1").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow(idemHash(tenantOrgB), 200, `{"message":"ticket created"}`))
+
+	var calls int
+	resp, body := doRequest(t, newIdempotentApp(tenantOrgA, &calls), "POST", "/api/ticket", idemBody, "Idempotency-Key", "k1")
+	if resp.StatusCode != 409 || calls != 0 || !strings.Contains(body, "different request") {
+		t.Fatalf("status %d calls %d body %s", resp.StatusCode, calls, body)
+	}
+}
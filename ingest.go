@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// batas jumlah entri per request ingest
+const maxIngestBatch = 500
+
+// Status per entri di laporan ingest
+const (
+	ingestCreated = "created"
+	ingestUpdated = "updated"
+	ingestFailed  = "failed"
+)
+
+type IngestEntry struct {
+	Date    string  `json:"date"`
+	Revenue float64 `json:"revenue"`
+	Expense float64 `json:"expense"`
+}
+
+type IngestResult struct {
+	Index      int     `json:"index"`
+	Date       string  `json:"date"`
+	Status     string  `json:"status"`
+	ID         int     `json:"id,omitempty"`
+	ProfitLoss float64 `json:"profitloss"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// =======================================
+// INGEST laba rugi harian (v1)
+// =======================================
+// Body: satu entri {"date", "revenue", "expense"}, array entri, atau {"entries": [...]}.
+// Upsert per (organisasi, tanggal); entri yang tidak valid dilaporkan tanpa
+// membatalkan entri lain.
+func ingestProfitLoss(c *fiber.Ctx) error {
+	entries, err := parseIngestBody(c.Body())
+	if err != nil || len(entries) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	if len(entries) > maxIngestBatch {
+		return c.Status(413).JSON(fiber.Map{"error": "too many entries", "max": maxIngestBatch})
+	}
+
+	userID := currentUserID(c)
+	orgID := currentOrgID(c)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	results := make([]IngestResult, len(entries))
+	summary := map[string]int{ingestCreated: 0, ingestUpdated: 0, ingestFailed: 0}
+	for i, e := range entries {
+		r, err := upsertIngestEntry(tx, userID, orgID, e)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		r.Index = i
+		results[i] = r
+		summary[r.Status]++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if summary[ingestCreated]+summary[ingestUpdated] > 0 {
+		invalidateStats(orgID)
+	}
+
+	return c.JSON(fiber.Map{"summary": summary, "results": results})
+}
+
+// error validasi masuk ke result, error database dikembalikan
+func upsertIngestEntry(tx *sql.Tx, userID, orgID int, e IngestEntry) (IngestResult, error) {
+	r := IngestResult{Date: e.Date, Status: ingestFailed}
+
+	if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+		r.Error = "invalid date, expected YYYY-MM-DD"
+		return r, nil
+	}
+	if e.Revenue < 0 || e.Expense < 0 {
+		r.Error = "revenue and expense must not be negative"
+		return r, nil
+	}
+	r.ProfitLoss = e.Revenue - e.Expense
+
+	// Baca biasa (tanpa FOR UPDATE): SELECT ... FOR UPDATE pada tanggal yang belum ada
+	// memasang gap lock, dua ingest paralel untuk tanggal baru yang sama jadi deadlock.
+	err := tx.QueryRow(
+		"SELECT id FROM profit_losses WHERE organization_id = ? AND date = ?", orgID, e.Date,
+	).Scan(&r.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		// request lain bisa saja baru meng-insert tanggal yang sama; unique key
+		// (organization_id, date) mengubahnya jadi update, LAST_INSERT_ID(id) = id baris itu
+		res, err := tx.Exec(`
+			INSERT INTO profit_losses (user_id, organization_id, date, revenue, expense, profitloss)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE
+				id = LAST_INSERT_ID(id), revenue = VALUES(revenue), expense = VALUES(expense), profitloss = VALUES(profitloss)
+		`, userID, orgID, e.Date, e.Revenue, e.Expense, r.ProfitLoss)
+		if err != nil {
+			return r, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return r, err
+		}
+		r.ID = int(id)
+		n, err := res.RowsAffected()
+		if err != nil {
+			return r, err
+		}
+		// 1 = baris baru; 2 = baris dari request lain ikut diupdate (nilai yang persis
+		// sama juga 1 karena clientFoundRows, tetap dilaporkan created)
+		if n == 1 {
+			r.Status = ingestCreated
+			return r, nil
+		}
+	case err != nil:
+		return r, err
+	default:
+		_, err := tx.Exec(
+			"UPDATE profit_losses SET revenue = ?, expense = ?, profitloss = ? WHERE id = ?",
+			e.Revenue, e.Expense, r.ProfitLoss, r.ID,
+		)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	// total dari ingest menggantikan rincian line item hari itu
+	if _, err := tx.Exec("DELETE FROM profit_loss_items WHERE profit_loss_id = ?", r.ID); err != nil {
+		return r, err
+	}
+	r.Status = ingestUpdated
+	return r, nil
+}
+
+func parseIngestBody(body []byte) ([]IngestEntry, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var entries []IngestEntry
+		err := json.Unmarshal(body, &entries)
+		return entries, err
+	}
+
+	var batch struct {
+		Entries []IngestEntry `json:"entries"`
+		IngestEntry
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, err
+	}
+	if batch.Entries != nil {
+		return batch.Entries, nil
+	}
+	return []IngestEntry{batch.IngestEntry}, nil
+}
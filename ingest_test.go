@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+type ingestResponse struct {
+	Summary map[string]int `json:"summary"`
+	Results []IngestResult `json:"results"`
+}
+
+func doIngest(t *testing.T, body string) (int, ingestResponse) {
+	t.Helper()
+	prev := statsSummaries
+	statsSummaries = newTestStatsCache(time.Minute)
+	t.Cleanup(func() { statsSummaries = prev })
+
+	app := newTestApp(tenantUserA, tenantOrgA, orgRoleOwner)
+	app.Post("/api/v1/ingest/profitloss", ingestProfitLoss)
+
+	resp, out := doRequest(t, app, "POST", "/api/v1/ingest/profitloss", body)
+	var parsed ingestResponse
+	if resp.StatusCode == 200 {
+		if err := json.Unmarshal([]byte(out), &parsed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, parsed
+}
+
+func expectIngestLookup(mock sqlmock.Sqlmock, date string, id int) {
+	rows := sqlmock.NewRows([]string{"id"})
+	if id != 0 {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery(q("SELECT id FROM profit_losses WHERE organization_id = ? AND date = ?")).
+		WithArgs(tenantOrgA, date).
+		WillReturnRows(rows)
+}
+
+// satu batch: tanggal baru, tanggal yang sudah ada, entri invalid
+func TestIngestCreateUpdateAndInvalid(t *testing.T) {
+	mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectIngestLookup(mock, "2025-03-01", 0)
+	mock.ExpectExec(q("INSERT INTO profit_losses")).
+		WithArgs(tenantUserA, tenantOrgA, "2025-03-01", 500.0, 200.0, 300.0).
+		WillReturnResult(sqlmock.NewResult(41, 1))
+	expectIngestLookup(mock, "2025-03-02", 12)
+	mock.ExpectExec(q("UPDATE profit_losses SET revenue = ?, expense = ?, profitloss = ? WHERE id = ?")).
+		WithArgs(100.0, 150.0, -50.0, 12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("DELETE FROM profit_loss_items WHERE profit_loss_id = ?")).
+		WithArgs(12).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	status, out := doIngest(t, `{"entries":[
+		{"date":"2025-03-01","revenue":500,"expense":200},
+		{"date":"2025-03-02","revenue":100,"expense":150},
+		{"date":"01-03-2025","revenue":1,"expense":1},
+		{"date":"2025-03-04","revenue":-1,"expense":0}
+	]}`)
+	if status != 200 {
+		t.Fatalf("status %d", status)
+	}
+	want := map[string]int{ingestCreated: 1, ingestUpdated: 1, ingestFailed: 2}
+	for k, v := range want {
+		if out.Summary[k] != v {
+			t.Errorf("summary[%s] = %d, want %d (%+v)", k, out.Summary[k], v, out.Summary)
+		}
+	}
+	if r := out.Results[0]; r.Status != ingestCreated || r.ID != 41 || r.ProfitLoss != 300 {
+		t.Errorf("results[0] = %+v", r)
+	}
+	if r := out.Results[1]; r.Status != ingestUpdated || r.ID != 12 {
+		t.Errorf("results[1] = %+v", r)
+	}
+	if r := out.Results[2]; r.Status != ingestFailed || r.Index != 2 || r.Error == "" {
+		t.Errorf("results[2] = %+v", r)
+	}
+	if r := out.Results[3]; r.Status != ingestFailed || r.Index != 3 || r.Error == "" {
+		t.Errorf("results[3] = %+v", r)
+	}
+}
+
+// tanggal yang sama di-insert request lain setelah SELECT: unique key mengubah
+// INSERT jadi update (affected 2), dilaporkan updated dan bukan 500
+func TestIngestConcurrentInsertBecomesUpdate(t *testing.T) {
+	mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectIngestLookup(mock, "2025-03-01", 0)
+	mock.ExpectExec(q("ON DUPLICATE KEY UPDATE")).
+		WithArgs(tenantUserA, tenantOrgA, "2025-03-01", 500.0, 200.0, 300.0).
+		WillReturnResult(sqlmock.NewResult(40, 2))
+	mock.ExpectExec(q("DELETE FROM profit_loss_items WHERE profit_loss_id = ?")).
+		WithArgs(40).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	status, out := doIngest(t, `{"date":"2025-03-01","revenue":500,"expense":200}`)
+	if status != 200 {
+		t.Fatalf("status %d", status)
+	}
+	if r := out.Results[0]; r.Status != ingestUpdated || r.ID != 40 {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+// tanggal yang sama dua kali dalam satu batch: entri kedua mengupdate hasil entri pertama
+func TestIngestDuplicateDateInBatch(t *testing.T) {
+	mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	expectIngestLookup(mock, "2025-03-01", 0)
+	mock.ExpectExec(q("INSERT INTO profit_losses")).
+		WillReturnResult(sqlmock.NewResult(41, 1))
+	expectIngestLookup(mock, "2025-03-01", 41)
+	mock.ExpectExec(q("UPDATE profit_losses SET revenue = ?, expense = ?, profitloss = ? WHERE id = ?")).
+		WithArgs(700.0, 200.0, 500.0, 41).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("DELETE FROM profit_loss_items WHERE profit_loss_id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	status, out := doIngest(t, `[
+		{"date":"2025-03-01","revenue":500,"expense":200},
+		{"date":"2025-03-01","revenue":700,"expense":200}
+	]`)
+	if status != 200 {
+		t.Fatalf("status %d", status)
+	}
+	if out.Results[0].Status != ingestCreated || out.Results[1].Status != ingestUpdated || out.Results[1].ID != 41 {
+		t.Errorf("results = %+v", out.Results)
+	}
+}
+
+func TestIngestRejectsBadBody(t *testing.T) {
+	newMockDB(t)
+	for _, body := range []string{``, `[]`, `{"entries":"x"}`} {
+		if status, _ := doIngest(t, body); status != 400 {
+			t.Errorf("body %q: status %d, want 400", body, status)
+		}
+	}
+}
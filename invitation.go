@@ -0,0 +1,395 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// masa berlaku link undangan
+const invitationTTL = 7 * 24 * time.Hour
+
+var errInvitationInvalid = errors.New("invitation invalid, expired or already used")
+
+type Invitation struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	InvitedBy string `json:"invited_by"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+// undangan yang masih bisa dipakai (hasil lockInvitation)
+type pendingInvitation struct {
+	id     int
+	orgID  int
+	email  string
+	role   string
+	userID int // 0 kalau email belum terdaftar
+}
+
+// =======================================
+// CREATE undangan (organisasi aktif)
+// =======================================
+func createInvitation(c *fiber.Ctx) error {
+	req := new(struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	})
+	if err := c.BodyParser(req); err != nil || !strings.Contains(req.Email, "@") || !validOrgRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Role == orgRoleOwner && c.Locals(localsOrgRole) != orgRoleOwner {
+		return c.Status(403).JSON(fiber.Map{"error": "only owner can invite another owner"})
+	}
+
+	orgID := currentOrgID(c)
+	inviterID := currentUserID(c)
+
+	// sudah jadi anggota?
+	var members int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM organization_members m JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = ? AND u.email = ?
+	`, orgID, req.Email).Scan(&members)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if members > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "user is already a member"})
+	}
+
+	var inviterName, inviterLocale, orgName string
+	err = db.QueryRow(`
+		SELECT u.name, u.locale, o.name FROM users u, organizations o WHERE u.id = ? AND o.id = ?
+	`, inviterID, orgID).Scan(&inviterName, &inviterLocale, &orgName)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// email undangan pakai bahasa penerima kalau sudah punya akun
+	locale := inviterLocale
+	err = db.QueryRow("SELECT locale FROM users WHERE email = ?", req.Email).Scan(&locale)
+	if err != nil && err != sql.ErrNoRows {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	token, err := generateSecureToken(32)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	now := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	// undangan lama ke email yang sama di organisasi ini dicabut
+	_, err = tx.Exec(`
+		UPDATE organization_invitations SET revoked_at = ?
+		WHERE organization_id = ? AND email = ?
+			AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL
+	`, now, orgID, req.Email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, orgID, req.Email, req.Role, hashToken(token), inviterID, now.Add(invitationTTL), now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	id, _ := res.LastInsertId()
+
+	msg, err := renderEmail("invitation", locale, req.Email, map[string]any{
+		"InviterName":      inviterName,
+		"OrganizationName": orgName,
+		"Role":             req.Role,
+		"AcceptLink":       invitationLink("accept", token),
+		"DeclineLink":      invitationLink("decline", token),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "invitation sent", "id": id, "email": req.Email, "role": req.Role})
+}
+
+// =======================================
+// LIST undangan pending (organisasi aktif)
+// =======================================
+func getInvitations(c *fiber.Ctx) error {
+	rows, err := db.Query(`
+		SELECT i.id, i.email, i.role, u.name, i.expires_at, i.created_at
+		FROM organization_invitations i
+		JOIN users u ON u.id = i.invited_by
+		WHERE i.organization_id = ?
+			AND i.accepted_at IS NULL AND i.declined_at IS NULL AND i.revoked_at IS NULL
+			AND i.expires_at > ?
+		ORDER BY i.created_at DESC
+	`, currentOrgID(c), time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(&i.ID, &i.Email, &i.Role, &i.InvitedBy, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		invitations = append(invitations, i)
+	}
+	return c.JSON(invitations)
+}
+
+// =======================================
+// REVOKE undangan
+// =======================================
+func revokeInvitation(c *fiber.Ctx) error {
+	err := execOwned(`
+		UPDATE organization_invitations SET revoked_at = ?
+		WHERE id = ? AND organization_id = ?
+			AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL
+	`, time.Now(), c.Params("id"), currentOrgID(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "invitation revoked"})
+}
+
+// =======================================
+// ACCEPT (link dari email)
+// =======================================
+// Email sudah terdaftar: langsung jadi anggota. Belum: arahkan ke form
+// registrasi singkat di front-end (POST /api/invitations/accept).
+func acceptInvitationHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(400).SendString("Invalid invitation link")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).SendString("Failed to accept invitation")
+	}
+	defer tx.Rollback()
+
+	inv, err := lockInvitation(tx, token)
+	if err != nil {
+		if err == errInvitationInvalid {
+			return c.Status(400).SendString("Invalid or expired invitation link")
+		}
+		return c.Status(500).SendString("Failed to accept invitation")
+	}
+
+	if inv.userID == 0 {
+		return c.Redirect(frontendURL()+"accept-invitation?token="+url.QueryEscape(token), fiber.StatusSeeOther)
+	}
+
+	if err := completeInvitation(tx, inv, inv.userID); err != nil {
+		return c.Status(500).SendString("Failed to accept invitation")
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).SendString("Failed to accept invitation")
+	}
+
+	return c.Redirect(frontendURL()+"?invitation=accepted", fiber.StatusSeeOther)
+}
+
+// =======================================
+// ACCEPT + REGISTER (registrasi singkat)
+// =======================================
+func acceptInvitationRegisterProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		Whatsapp string `json:"whatsapp"`
+		Password string `json:"password"`
+		Locale   string `json:"locale"`
+	})
+	if err := c.BodyParser(req); err != nil || req.Token == "" || req.Name == "" || req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	inv, err := lockInvitation(tx, req.Token)
+	if err != nil {
+		if err == errInvitationInvalid {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid or expired invitation"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if inv.userID != 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "email already registered, please login and open the invitation link"})
+	}
+
+	if violations := validatePassword(req.Password, inv.email, req.Name); len(violations) > 0 {
+		return passwordPolicyError(c, violations)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	var orgName string
+	if err := tx.QueryRow("SELECT name FROM organizations WHERE id = ?", inv.orgID).Scan(&orgName); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// email sudah terbukti lewat link undangan: langsung aktif & terverifikasi
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO users (role_id, name, email, password, is_active, organization, whatsapp, email_verified_at, access_to_product_1, locale)
+		VALUES (?, ?, ?, ?, 1, ?, ?, ?, 1, ?)
+	`,
+		roleMember, req.Name, inv.email, string(hashedPassword),
+		orgName, req.Whatsapp, now, normalizeLocale(req.Locale),
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	lastID, _ := result.LastInsertId()
+	userID := int(lastID)
+
+	if _, err := grantEntitlement(tx, userID, productProfitLoss, now, nil, 0); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := completeInvitation(tx, inv, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	session, err := issueSession(c, tx, userID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	user, err := getUserByID(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	session["message"] = "invitation accepted"
+	session["user"] = user
+	session["organization_id"] = inv.orgID
+	return c.JSON(session)
+}
+
+// =======================================
+// DECLINE (link dari email)
+// =======================================
+func declineInvitationHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(400).SendString("Invalid invitation link")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).SendString("Failed to decline invitation")
+	}
+	defer tx.Rollback()
+
+	inv, err := lockInvitation(tx, token)
+	if err != nil {
+		if err == errInvitationInvalid {
+			return c.Status(400).SendString("Invalid or expired invitation link")
+		}
+		return c.Status(500).SendString("Failed to decline invitation")
+	}
+
+	if _, err := tx.Exec("UPDATE organization_invitations SET declined_at = ? WHERE id = ?", time.Now(), inv.id); err != nil {
+		return c.Status(500).SendString("Failed to decline invitation")
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).SendString("Failed to decline invitation")
+	}
+
+	return c.Redirect(frontendURL()+"?invitation=declined", fiber.StatusSeeOther)
+}
+
+// =======================================
+// HELPER
+// =======================================
+func invitationLink(action, token string) string {
+	apiURL := os.Getenv("VPS_APP_URL")
+	return fmt.Sprintf("%sapi/invitations/%s?token=%s", apiURL, action, token)
+}
+
+// ambil + lock undangan yang masih pending dan belum kadaluarsa
+func lockInvitation(tx *sql.Tx, token string) (pendingInvitation, error) {
+	var (
+		inv     pendingInvitation
+		closed  bool
+		expired bool
+	)
+	err := tx.QueryRow(`
+		SELECT id, organization_id, email, role,
+			(accepted_at IS NOT NULL OR declined_at IS NOT NULL OR revoked_at IS NOT NULL),
+			expires_at <= ?
+		FROM organization_invitations
+		WHERE token_hash = ?
+		FOR UPDATE
+	`, time.Now(), hashToken(token)).Scan(&inv.id, &inv.orgID, &inv.email, &inv.role, &closed, &expired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return inv, errInvitationInvalid
+		}
+		return inv, err
+	}
+	if closed || expired {
+		return inv, errInvitationInvalid
+	}
+
+	err = tx.QueryRow("SELECT id FROM users WHERE email = ?", inv.email).Scan(&inv.userID)
+	if err != nil && err != sql.ErrNoRows {
+		return inv, err
+	}
+	return inv, nil
+}
+
+// tambahkan user ke organisasi (kalau belum) + tandai undangan diterima
+func completeInvitation(tx *sql.Tx, inv pendingInvitation, userID int) error {
+	_, err := tx.Exec(`
+		INSERT IGNORE INTO organization_members (organization_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+	`, inv.orgID, userID, inv.role, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE organization_invitations SET accepted_at = ? WHERE id = ?", time.Now(), inv.id)
+	return err
+}
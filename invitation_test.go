@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testInvitationToken = "undangan-token"
+
+var invitationColumns = []string{"id", "organization_id", "email", "role", "closed", "expired"}
+
+// baris undangan (id 4, organisasi A, role member) + lookup user berdasarkan email
+func expectInvitation(mock sqlmock.Sqlmock, email string, closed, expired bool, userID int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(q("FROM organization_invitations")).
+		WithArgs(sqlmock.AnyArg(), hashToken(testInvitationToken)).
+		WillReturnRows(sqlmock.NewRows(invitationColumns).AddRow(4, tenantOrgA, email, orgRoleMember, closed, expired))
+	if closed || expired {
+		return
+	}
+	users := sqlmock.NewRows([]string{"id"})
+	if userID != 0 {
+		users.AddRow(userID)
+	}
+	mock.ExpectQuery(q("SELECT id FROM users WHERE email = ?")).
+		WithArgs(email).
+		WillReturnRows(users)
+}
+
+func newInvitationApp(t *testing.T) *fiber.App {
+	t.Setenv("FRONTEND_URL", "https://dash.example.test/")
+	app := newTestApp(0, 0, "")
+	app.Get("/api/invitations/accept", acceptInvitationHandler)
+	app.Post("/api/invitations/accept", acceptInvitationRegisterProcess)
+	app.Get("/api/invitations/decline", declineInvitationHandler)
+	return app
+}
+
+func TestAcceptInvitationExistingUser(t *testing.T) {
+	mock := newMockDB(t)
+	app := newInvitationApp(t)
+
+	expectInvitation(mock, "ani@example.com", false, false, tenantUserB)
+	mock.ExpectExec(q("INSERT IGNORE INTO organization_members")).
+		WithArgs(tenantOrgA, tenantUserB, orgRoleMember, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("UPDATE organization_invitations SET accepted_at = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, body := doRequest(t, app, "GET", "/api/invitations/accept?token="+testInvitationToken, "")
+	if resp.StatusCode != 303 || resp.Header.Get(fiber.HeaderLocation) != "https://dash.example.test/?invitation=accepted" {
+		t.Fatalf("status %d location %q body %s", resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), body)
+	}
+}
+
+// email belum terdaftar: diarahkan ke form registrasi, undangan belum diterima
+func TestAcceptInvitationNewUserRedirectsToRegister(t *testing.T) {
+	mock := newMockDB(t)
+	app := newInvitationApp(t)
+
+	expectInvitation(mock, "baru@example.com", false, false, 0)
+	mock.ExpectRollback()
+
+	resp, body := doRequest(t, app, "GET", "/api/invitations/accept?token="+testInvitationToken, "")
+	want := "https://dash.example.test/accept-invitation?token=" + testInvitationToken
+	if resp.StatusCode != 303 || resp.Header.Get(fiber.HeaderLocation) != want {
+		t.Fatalf("status %d location %q body %s", resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), body)
+	}
+}
+
+func TestAcceptInvitationRegister(t *testing.T) {
+	setTestTokenConfig(t)
+	mock := newMockDB(t)
+	app := newInvitationApp(t)
+
+	const newUserID = 30
+	expectInvitation(mock, "baru@example.com", false, false, 0)
+	mock.ExpectQuery(q("SELECT name FROM organizations WHERE id = ?")).
+		WithArgs(tenantOrgA).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Toko Budi"))
+	mock.ExpectExec(q("INSERT INTO users")).
+		WithArgs(roleMember, "Sari", "baru@example.com", sqlmock.AnyArg(), "Toko Budi", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(newUserID, 1))
+	mock.ExpectExec(q("INSERT INTO user_product_entitlements")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("INSERT IGNORE INTO organization_members")).
+		WithArgs(tenantOrgA, newUserID, orgRoleMember, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("UPDATE organization_invitations SET accepted_at = ? WHERE id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("INSERT INTO refresh_tokens")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(q("SELECT token_version FROM users WHERE id = ?")).
+		WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(q("FROM users")).
+		WithArgs(newUserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role_id", "name", "email", "organization", "whatsapp", "locale"}).
+			AddRow(newUserID, roleMember, "Sari", "baru@example.com", "Toko Budi", "", "id"))
+	mock.ExpectQuery(q("FROM user_product_entitlements")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	resp, body := doRequest(t, app, "POST", "/api/invitations/accept",
+		`{"token":"`+testInvitationToken+`","name":"Sari","password":"rahasia-kuat-123"}`)
+	if resp.StatusCode != 200 || !strings.Contains(body, `"refresh_token"`) || !strings.Contains(body, `"organization_id":10`) {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+}
+
+func TestDeclineInvitation(t *testing.T) {
+	mock := newMockDB(t)
+	app := newInvitationApp(t)
+
+	expectInvitation(mock, "ani@example.com", false, false, tenantUserB)
+	mock.ExpectExec(q("UPDATE organization_invitations SET declined_at = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, body := doRequest(t, app, "GET", "/api/invitations/decline?token="+testInvitationToken, "")
+	if resp.StatusCode != 303 || resp.Header.Get(fiber.HeaderLocation) != "https://dash.example.test/?invitation=declined" {
+		t.Fatalf("status %d location %q body %s", resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), body)
+	}
+}
+
+// undangan kadaluarsa / sudah diterima / ditolak / dicabut tidak bisa dipakai lagi
+func TestInvitationClosedOrExpired(t *testing.T) {
+	tests := []struct {
+		name            string
+		closed, expired bool
+		method, path    string
+		body            string
+	}{
+		{"accept expired", false, true, "GET", "/api/invitations/accept?token=" + testInvitationToken, ""},
+		{"accept closed", true, false, "GET", "/api/invitations/accept?token=" + testInvitationToken, ""},
+		{"decline expired", false, true, "GET", "/api/invitations/decline?token=" + testInvitationToken, ""},
+		{"register expired", false, true, "POST", "/api/invitations/accept",
+			`{"token":"` + testInvitationToken + `","name":"Sari","password":"rahasia-kuat-123"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDB(t)
+			app := newInvitationApp(t)
+
+			expectInvitation(mock, "ani@example.com", tt.closed, tt.expired, 0)
+			mock.ExpectRollback()
+
+			resp, body := doRequest(t, app, tt.method, tt.path, tt.body)
+			if resp.StatusCode != 400 {
+				t.Fatalf("status %d body %s, want 400", resp.StatusCode, body)
+			}
+		})
+	}
+}
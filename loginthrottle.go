@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Perlindungan brute-force login: gagal berulang -> delay makin lama -> lock sementara.
+// Key berbentuk "ip:<ip>" atau "email:<email>".
+type loginAttempt struct {
+	Failures     int
+	LastFailedAt time.Time
+	BlockedUntil time.Time
+}
+
+type loginAttemptStore interface {
+	Get(key string) (loginAttempt, error)
+	// Fail menambah 1 kegagalan lalu menyimpan BlockedUntil hasil block(failures)
+	Fail(key string, now time.Time, block func(failures int) time.Duration) (loginAttempt, error)
+	Reset(key string) error
+}
+
+// aturan per jenis key
+type throttlePolicy struct {
+	freeAttempts int           // gagal sebanyak ini belum kena delay
+	lockAfter    int           // mulai gagal ke-n akun/IP dikunci
+	lockDuration time.Duration // lama kunci
+	maxDelay     time.Duration // delay progresif maksimal sebelum lock
+}
+
+var (
+	accountThrottle = throttlePolicy{freeAttempts: 3, lockAfter: 10, lockDuration: 15 * time.Minute, maxDelay: time.Minute}
+	ipThrottle      = throttlePolicy{freeAttempts: 10, lockAfter: 50, lockDuration: 30 * time.Minute, maxDelay: time.Minute}
+
+	// kegagalan lebih lama dari ini tidak dihitung lagi
+	failureWindow = time.Hour
+
+	loginAttempts loginAttemptStore
+)
+
+func (p throttlePolicy) block(failures int) time.Duration {
+	if failures >= p.lockAfter {
+		return p.lockDuration
+	}
+	if failures < p.freeAttempts {
+		return 0
+	}
+	// 1s, 2s, 4s, ... sampai maxDelay
+	d := time.Second << (failures - p.freeAttempts)
+	if d > p.maxDelay || d <= 0 {
+		d = p.maxDelay
+	}
+	return d
+}
+
+// =======================================
+// INIT: pilih store dari env
+// =======================================
+func newLoginAttemptStoreFromEnv() (loginAttemptStore, error) {
+	switch store := getEnv("LOGIN_THROTTLE_STORE", "memory"); store {
+	case "memory":
+		return &memoryAttemptStore{entries: map[string]loginAttempt{}}, nil
+	case "mysql":
+		return &mysqlAttemptStore{}, nil
+	default:
+		return nil, fmt.Errorf("unknown LOGIN_THROTTLE_STORE: %s", store)
+	}
+}
+
+// =======================================
+// GUARD: dipanggil dari loginProcess
+// =======================================
+func loginThrottleKeys(c *fiber.Ctx, email string) (ipKey, emailKey string) {
+	return "ip:" + c.IP(), "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// sisa waktu tunggu (0 = boleh coba login)
+func loginRetryAfter(c *fiber.Ctx, email string) (time.Duration, error) {
+	ipKey, emailKey := loginThrottleKeys(c, email)
+	now := time.Now()
+
+	var wait time.Duration
+	for _, key := range []string{ipKey, emailKey} {
+		st, err := loginAttempts.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := st.BlockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// catat login gagal untuk IP & email, audit kalau baru saja terkunci
+func recordLoginFailure(c *fiber.Ctx, email string, userID int) {
+	ipKey, emailKey := loginThrottleKeys(c, email)
+	now := time.Now()
+
+	for _, k := range []struct {
+		key    string
+		policy throttlePolicy
+	}{{ipKey, ipThrottle}, {emailKey, accountThrottle}} {
+		st, err := loginAttempts.Fail(k.key, now, k.policy.block)
+		if err != nil {
+			log.Println("login throttle:", err)
+			continue
+		}
+		if st.Failures == k.policy.lockAfter {
+			recordAuthEvent(userID, email, c.IP(), "login_lockout:"+strings.SplitN(k.key, ":", 2)[0])
+		}
+	}
+}
+
+// login sukses: reset hitungan akun (IP tidak di-reset)
+func recordLoginSuccess(c *fiber.Ctx, email string) {
+	_, emailKey := loginThrottleKeys(c, email)
+	if err := loginAttempts.Reset(emailKey); err != nil {
+		log.Println("login throttle:", err)
+	}
+}
+
+// helper respon 429
+func tooManyLoginAttempts(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(wait.Seconds() + 0.999)
+	c.Set(fiber.HeaderRetryAfter, fmt.Sprint(seconds))
+	return c.Status(429).JSON(fiber.Map{
+		"error":       "too many failed login attempts, please try again later",
+		"retry_after": seconds,
+	})
+}
+
+// =======================================
+// AUDIT LOG
+// =======================================
+func recordAuthEvent(userID int, email, ip, event string) {
+	var uid any
+	if userID != 0 {
+		uid = userID
+	}
+	_, err := db.Exec(
+		"INSERT INTO auth_audit_log (user_id, email, ip_address, event, created_at) VALUES (?, ?, ?, ?, ?)",
+		uid, email, ip, event, time.Now(),
+	)
+	if err != nil {
+		log.Println("auth audit:", err)
+	}
+}
+
+// =======================================
+// STORE: in-memory (single instance)
+// =======================================
+type memoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]loginAttempt
+}
+
+func (s *memoryAttemptStore) Get(key string) (loginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *memoryAttemptStore) Fail(key string, now time.Time, block func(int) time.Duration) (loginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// buang entry basi supaya map tidak tumbuh terus
+	if len(s.entries) > 10000 {
+		for k, st := range s.entries {
+			if now.Sub(st.LastFailedAt) > failureWindow && now.After(st.BlockedUntil) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	st := s.entries[key]
+	if now.Sub(st.LastFailedAt) > failureWindow {
+		st.Failures = 0
+	}
+	st.Failures++
+	st.LastFailedAt = now
+	st.BlockedUntil = now.Add(block(st.Failures))
+	s.entries[key] = st
+	return st, nil
+}
+
+func (s *memoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// =======================================
+// STORE: MySQL (beberapa instance)
+// =======================================
+type mysqlAttemptStore struct{}
+
+func (s *mysqlAttemptStore) Get(key string) (loginAttempt, error) {
+	var st loginAttempt
+	err := db.QueryRow(
+		"SELECT failures, last_failed_at, blocked_until FROM login_attempts WHERE throttle_key = ?", key,
+	).Scan(&st.Failures, (*mysqlTime)(&st.LastFailedAt), (*mysqlTime)(&st.BlockedUntil))
+	if err == sql.ErrNoRows {
+		return loginAttempt{}, nil
+	}
+	return st, err
+}
+
+func (s *mysqlAttemptStore) Fail(key string, now time.Time, block func(int) time.Duration) (loginAttempt, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return loginAttempt{}, err
+	}
+	defer tx.Rollback()
+
+	// pastikan baris ada, lalu lock
+	_, err = tx.Exec(`
+		INSERT INTO login_attempts (throttle_key, failures, last_failed_at, blocked_until)
+		VALUES (?, 0, ?, ?)
+		ON DUPLICATE KEY UPDATE throttle_key = throttle_key
+	`, key, now, now)
+	if err != nil {
+		return loginAttempt{}, err
+	}
+
+	var st loginAttempt
+	err = tx.QueryRow(
+		"SELECT failures, last_failed_at FROM login_attempts WHERE throttle_key = ? FOR UPDATE", key,
+	).Scan(&st.Failures, (*mysqlTime)(&st.LastFailedAt))
+	if err != nil {
+		return loginAttempt{}, err
+	}
+
+	if now.Sub(st.LastFailedAt) > failureWindow {
+		st.Failures = 0
+	}
+	st.Failures++
+	st.LastFailedAt = now
+	st.BlockedUntil = now.Add(block(st.Failures))
+
+	_, err = tx.Exec(
+		"UPDATE login_attempts SET failures = ?, last_failed_at = ?, blocked_until = ? WHERE throttle_key = ?",
+		st.Failures, st.LastFailedAt, st.BlockedUntil, key,
+	)
+	if err != nil {
+		return loginAttempt{}, err
+	}
+	return st, tx.Commit()
+}
+
+func (s *mysqlAttemptStore) Reset(key string) error {
+	_, err := db.Exec("DELETE FROM login_attempts WHERE throttle_key = ?", key)
+	return err
+}
+
+// mysqlTime: scan DATETIME (tanpa parseTime) sebagai waktu UTC
+type mysqlTime time.Time
+
+func (t *mysqlTime) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case time.Time:
+		*t = mysqlTime(v)
+		return nil
+	case nil:
+		*t = mysqlTime(time.Time{})
+		return nil
+	default:
+		return fmt.Errorf("unsupported time type %T", src)
+	}
+	parsed, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.UTC)
+	if err != nil {
+		return err
+	}
+	*t = mysqlTime(parsed)
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestAttemptStore(t *testing.T) *memoryAttemptStore {
+	t.Helper()
+	store := &memoryAttemptStore{entries: map[string]loginAttempt{}}
+	prev := loginAttempts
+	loginAttempts = store
+	t.Cleanup(func() { loginAttempts = prev })
+	return store
+}
+
+// email tidak terdaftar: login gagal tanpa query lain
+func expectUnknownLogin(mock sqlmock.Sqlmock, email string) {
+	mock.ExpectQuery(q("FROM users")).
+		WithArgs(email).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func TestThrottlePolicyBlock(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{8, 32 * time.Second},
+		{9, time.Minute},
+		{10, 15 * time.Minute},
+		{11, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := accountThrottle.block(tt.failures); got != tt.want {
+			t.Errorf("block(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// gagal ke-3 mulai kena delay: request berikutnya 429 + Retry-After
+func TestLoginProgressiveDelay(t *testing.T) {
+	const email = "budi@example.com"
+	mock := newMockDB(t)
+	newTestAttemptStore(t)
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/login", loginProcess)
+	body := `{"email":"` + email + `","password":"salah"}`
+
+	for i := 1; i <= accountThrottle.freeAttempts; i++ {
+		expectUnknownLogin(mock, email)
+		if resp, out := doRequest(t, app, "POST", "/api/login", body); resp.StatusCode != 401 {
+			t.Fatalf("attempt %d: status %d body %s", i, resp.StatusCode, out)
+		}
+	}
+
+	resp, out := doRequest(t, app, "POST", "/api/login", body)
+	if resp.StatusCode != 429 || resp.Header.Get(fiber.HeaderRetryAfter) != "1" {
+		t.Fatalf("after %d failures: status %d Retry-After %q body %s",
+			accountThrottle.freeAttempts, resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter), out)
+	}
+}
+
+// gagal ke-10 mengunci akun 15 menit dan dicatat di audit log
+func TestLoginAccountLockout(t *testing.T) {
+	const email = "budi@example.com"
+	mock := newMockDB(t)
+	store := newTestAttemptStore(t)
+	store.entries["email:"+email] = loginAttempt{
+		Failures:     accountThrottle.lockAfter - 1,
+		LastFailedAt: time.Now().Add(-2 * time.Minute),
+	}
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/login", loginProcess)
+	body := `{"email":"` + email + `","password":"salah"}`
+
+	expectUnknownLogin(mock, email)
+	mock.ExpectExec(q("INSERT INTO auth_audit_log")).
+		WithArgs(nil, email, sqlmock.AnyArg(), "login_lockout:email", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if resp, out := doRequest(t, app, "POST", "/api/login", body); resp.StatusCode != 401 {
+		t.Fatalf("locking attempt: status %d body %s", resp.StatusCode, out)
+	}
+
+	resp, out := doRequest(t, app, "POST", "/api/login", body)
+	retryAfter, _ := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	if resp.StatusCode != 429 || retryAfter < 899 || retryAfter > 900 {
+		t.Fatalf("locked: status %d Retry-After %d body %s", resp.StatusCode, retryAfter, out)
+	}
+
+	// email lain dari IP yang sama tidak ikut terkunci
+	expectUnknownLogin(mock, "ani@example.com")
+	if resp, out := doRequest(t, app, "POST", "/api/login", `{"email":"ani@example.com","password":"salah"}`); resp.StatusCode != 401 {
+		t.Fatalf("other account: status %d body %s", resp.StatusCode, out)
+	}
+}
+
+// Di belakang proxy terpercaya, lock per IP hanya berlaku untuk IP client itu,
+// bukan untuk semua request yang lewat proxy.
+func TestLoginIPLockoutBehindProxy(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "0.0.0.0") // alamat koneksi app.Test
+	t.Setenv("PROXY_HEADER", "X-Real-IP")
+
+	mock := newMockDB(t)
+	store := newTestAttemptStore(t)
+	store.entries["ip:203.0.113.5"] = loginAttempt{
+		Failures:     ipThrottle.lockAfter,
+		LastFailedAt: time.Now(),
+		BlockedUntil: time.Now().Add(ipThrottle.lockDuration),
+	}
+
+	app := fiber.New(fiberConfig())
+	app.Post("/api/login", loginProcess)
+	body := `{"email":"budi@example.com","password":"salah"}`
+
+	resp, out := doRequest(t, app, "POST", "/api/login", body, "X-Real-IP", "203.0.113.5")
+	if resp.StatusCode != 429 {
+		t.Fatalf("locked IP: status %d body %s", resp.StatusCode, out)
+	}
+
+	expectUnknownLogin(mock, "budi@example.com")
+	resp, out = doRequest(t, app, "POST", "/api/login", body, "X-Real-IP", "198.51.100.7")
+	if resp.StatusCode != 401 {
+		t.Fatalf("other client IP: status %d body %s", resp.StatusCode, out)
+	}
+	if _, ok := store.entries["ip:198.51.100.7"]; !ok {
+		t.Error("failure not recorded under the client IP")
+	}
+}
+
+// tanpa TRUSTED_PROXIES header IP dari client diabaikan (tidak bisa dipakai lolos dari lock)
+func TestFiberConfigIgnoresProxyHeaderByDefault(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	app := fiber.New(fiberConfig())
+	app.Get("/ip", func(c *fiber.Ctx) error { return c.SendString(c.IP()) })
+
+	if _, out := doRequest(t, app, "GET", "/ip", "", "X-Real-IP", "203.0.113.5"); out != "0.0.0.0" {
+		t.Fatalf("IP = %s, want connection address", out)
+	}
+}
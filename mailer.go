@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message = satu email keluar (HTML boleh kosong)
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer = backend pengirim email (smtp / file / memory)
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var mailer Mailer
+
+// =======================================
+// INIT: pilih backend dari env
+// =======================================
+func newMailerFromEnv(stage string) (Mailer, error) {
+	defaultDriver := "smtp"
+	if stage == "dev" {
+		defaultDriver = "file"
+	}
+
+	switch driver := getEnv("MAIL_DRIVER", defaultDriver); driver {
+	case "smtp":
+		m := &smtpMailer{
+			host:     getEnv("MAIL_HOST", ""),
+			port:     getEnv("MAIL_PORT", "587"),
+			username: getEnv("MAIL_USERNAME", ""),
+			password: getEnv("MAIL_PASSWORD", ""),
+			from:     getEnv("MAIL_FROM", ""),
+		}
+		if m.host == "" || m.from == "" {
+			return nil, fmt.Errorf("MAIL_HOST and MAIL_FROM are required for smtp mailer")
+		}
+		return m, nil
+	case "file":
+		return &fileMailer{
+			path: getEnv("MAIL_FILE", ""),
+			from: getEnv("MAIL_FROM", "no-reply@localhost"),
+		}, nil
+	case "memory":
+		return &memoryMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER: %s", driver)
+	}
+}
+
+// =======================================
+// SMTP
+// =======================================
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (m *smtpMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	raw, err := buildMIMEMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.host+":"+m.port, auth, m.from, []string{msg.To}, raw)
+}
+
+// =======================================
+// MIME: multipart/alternative (text + html)
+// =======================================
+func buildMIMEMessage(from string, msg Message) ([]byte, error) {
+	var b bytes.Buffer
+	now := time.Now()
+
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.TrimRight(from[i+1:], ">")
+	}
+	messageID, err := generateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", strings.NewReplacer("\r", "", "\n", "").Replace(msg.To))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", now.Format(time.RFC1123Z))
+	header.Set("Message-ID", fmt.Sprintf("<%s@%s>", messageID, domain))
+	header.Set("MIME-Version", "1.0")
+
+	mw := multipart.NewWriter(&b)
+	if msg.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=UTF-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+	} else {
+		header.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	}
+
+	// header utama (urut supaya output stabil)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var head bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&head, "%s: %s\r\n", k, header.Get(k))
+	}
+	head.WriteString("\r\n")
+
+	if msg.HTML == "" {
+		if err := writeQuotedPrintable(&head, msg.Text); err != nil {
+			return nil, err
+		}
+		return head.Bytes(), nil
+	}
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, p.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(head.Bytes(), b.Bytes()...), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// =======================================
+// FILE / LOG (untuk dev)
+// =======================================
+// path kosong = tulis ke log; isinya pesan MIME lengkap seperti yang dikirim SMTP
+type fileMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func (m *fileMailer) Send(msg Message) error {
+	raw, err := buildMIMEMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+	entry := fmt.Sprintf("==== %s\n%s\n\n", time.Now().Format(time.RFC3339), raw)
+
+	if m.path == "" {
+		log.Print("mail:\n" + entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry)
+	return err
+}
+
+// =======================================
+// MEMORY (untuk test)
+// =======================================
+type memoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *memoryMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages mengembalikan salinan semua email yang "terkirim"
+func (m *memoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func (m *memoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
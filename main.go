@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gofiber/fiber/v2"
@@ -14,6 +16,17 @@ import (
 
 var db *sql.DB
 
+// execer dipenuhi oleh *sql.DB maupun *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// dbtx = execer + QueryRow, juga dipenuhi *sql.DB maupun *sql.Tx
+type dbtx interface {
+	execer
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 func main() {
 	// Load .env
 	err := godotenv.Load()
@@ -25,24 +38,25 @@ func main() {
 	stage := getEnv("APP_STAGE", "dev")
 
 	// Tentukan koneksi database sesuai stage
+	// clientFoundRows: RowsAffected = baris yang cocok, bukan yang berubah
 	var dsn string
 	switch stage {
 	case "dev":
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s",
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?clientFoundRows=true",
 			getEnv("LOCAL_DB_USER", "root"),
 			getEnv("LOCAL_DB_PASSWORD", ""),
 			getEnv("LOCAL_DB_HOST", "127.0.0.1"),
 			getEnv("LOCAL_DB_NAME", "mysaas"),
 		)
 	case "vpn":
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s",
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?clientFoundRows=true",
 			getEnv("VPN_DB_USER", "root"),
 			getEnv("VPN_DB_PASSWORD", ""),
 			getEnv("VPN_DB_HOST", "127.0.0.1"),
 			getEnv("VPN_DB_NAME", "mysaas"),
 		)
 	case "vps":
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s",
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?clientFoundRows=true",
 			getEnv("VPS_DB_USER", "andik"),
 			getEnv("VPS_DB_PASSWORD", ""),
 			getEnv("VPS_DB_HOST", "127.0.0.1"),
@@ -52,6 +66,16 @@ func main() {
 		log.Fatal("Unknown APP_STAGE: ", stage)
 	}
 
+	// Secret untuk token login
+	initTokenConfig(stage)
+	initPasswordPolicy()
+
+	// Pengirim email
+	mailer, err = newMailerFromEnv(stage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// log.Println("APP_STAGE:", stage)
 	// log.Println("Using DSN:", dsn)
 
@@ -62,34 +86,186 @@ func main() {
 	}
 	defer db.Close()
 
+	// Jalankan migrasi tabel tambahan
+	if err := migrate(); err != nil {
+		log.Fatal("migration failed: ", err)
+	}
+
+	// Penyimpanan hitungan login gagal
+	loginAttempts, err = newLoginAttemptStoreFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Cache ringkasan stats per organisasi
+	statsCacheTTL, err := time.ParseDuration(getEnv("STATS_CACHE_TTL", "5m"))
+	if err != nil {
+		log.Fatal("invalid STATS_CACHE_TTL: ", err)
+	}
+	statsSummaries, err = newStatsCacheFromEnv(statsCacheTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Masa simpan response Idempotency-Key
+	idempotencyTTL, err = time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		log.Fatal("invalid IDEMPOTENCY_TTL: ", err)
+	}
+
+	// Worker pengirim email dari outbox
+	pollInterval, err := time.ParseDuration(getEnv("OUTBOX_POLL_INTERVAL", "5s"))
+	if err != nil {
+		log.Fatal("invalid OUTBOX_POLL_INTERVAL: ", err)
+	}
+	startOutboxWorker(pollInterval)
+
+	// Purge akun yang sudah lewat masa tenggang hapus akun
+	accountDeletionGrace, err = time.ParseDuration(getEnv("ACCOUNT_DELETION_GRACE", "336h"))
+	if err != nil {
+		log.Fatal("invalid ACCOUNT_DELETION_GRACE: ", err)
+	}
+	purgeInterval, err := time.ParseDuration(getEnv("ACCOUNT_PURGE_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatal("invalid ACCOUNT_PURGE_INTERVAL: ", err)
+	}
+	startAccountPurgeWorker(purgeInterval)
+
 	// Fiber setup
-	app := fiber.New()
+	app := fiber.New(fiberConfig())
 	app.Use(cors.New())
 
+	setupRoutes(app)
+
+	// Jalankan server di port dari .env
+	appPort := getEnv("APP_PORT", "3001")
+	log.Fatal(app.Listen(":" + appPort))
+}
+
+// =======================================
+// FIBER CONFIG
+// =======================================
+// Di belakang reverse proxy, IP koneksi selalu IP proxy sehingga throttle login per IP
+// akan mengunci semua client sekaligus. Kalau TRUSTED_PROXIES diisi (IP/CIDR, dipisah koma),
+// IP client diambil dari PROXY_HEADER, tapi hanya untuk request yang datang dari proxy itu.
+func fiberConfig() fiber.Config {
+	var proxies []string
+	for _, p := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if len(proxies) == 0 {
+		return fiber.Config{}
+	}
+	return fiber.Config{
+		// X-Real-IP di-set ulang oleh proxy; X-Forwarded-For bisa diisi client sendiri
+		ProxyHeader:             getEnv("PROXY_HEADER", "X-Real-IP"),
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          proxies,
+		EnableIPValidation:      true,
+	}
+}
+
+// =======================================
+// ROUTES
+// =======================================
+// dipisah dari main supaya test bisa memakai rantai middleware yang sama
+func setupRoutes(app *fiber.App) {
 	// ===== Auth =====
 	app.Post("/api/login", loginProcess)
 	app.Post("/api/register", registerProcess)
-	app.Post("/api/change-password", changePasswordProcess)
+	app.Post("/api/change-password", authRequired, changePasswordProcess)
 	app.Get("/api/verify", verifyEmailHandler)
+	app.Post("/api/verify/resend", resendVerificationProcess)
+	app.Post("/api/password/forgot", forgotPasswordProcess)
+	app.Post("/api/password/reset", resetPasswordProcess)
+	app.Get("/api/password/policy", getPasswordPolicy)
+	app.Post("/api/token/refresh", refreshTokenProcess)
+	app.Post("/api/logout", logoutProcess)
+	app.Post("/api/logout/all", authRequired, logoutAllProcess)
+	app.Post("/api/login/2fa", twoFactorLoginProcess)
+
+	// ===== Profile =====
+	// link konfirmasi email baru (publik, token sekali pakai)
+	app.Get("/api/me/email/confirm", confirmEmailChangeHandler)
+	app.Get("/api/me/delete/confirm", confirmAccountDeletionHandler)
+	me := app.Group("/api/me", authRequired)
+	me.Get("/", getMe)
+	me.Put("/", updateMe)
+	me.Post("/email", changeEmailProcess)
+	me.Get("/export", exportMyData)
+	me.Post("/delete", requestAccountDeletion)
+	me.Delete("/delete", cancelAccountDeletion)
+
+	// ===== Two-Factor =====
+	twoFactor := app.Group("/api/2fa", authRequired)
+	twoFactor.Post("/setup", twoFactorSetupProcess)
+	twoFactor.Post("/confirm", twoFactorConfirmProcess)
+	twoFactor.Post("/disable", twoFactorDisableProcess)
 
 	// ===== ProfitLoss CRUD =====
-	app.Post("/api/profitloss/stats", getProfitLossStats)
-	app.Post("/api/profitloss/list", getAllProfitLoss)
-	app.Get("/api/profitloss/:id", getProfitLossByID)
-	app.Post("/api/profitloss", createProfitLoss)
-	app.Put("/api/profitloss/:id", updateProfitLoss)
-	app.Delete("/api/profitloss/:id", deleteProfitLoss)
+	profitloss := app.Group("/api/profitloss", authRequiredOrAPIKey, requireEntitlement(productProfitLoss), orgContext)
+	profitloss.Post("/stats", requirePermission(permProfitLossRead), getProfitLossStats)
+	profitloss.Get("/categories", requirePermission(permProfitLossRead), getCategories)
+	profitloss.Post("/categories", requirePermission(permProfitLossWrite), createCategory)
+	profitloss.Put("/categories/:id", requirePermission(permProfitLossWrite), updateCategory)
+	profitloss.Delete("/categories/:id", requirePermission(permProfitLossWrite), deleteCategory)
+	profitloss.Post("/list", requirePermission(permProfitLossRead), getAllProfitLoss)
+	profitloss.Get("/:id", requirePermission(permProfitLossRead), getProfitLossByID)
+	profitloss.Post("/", requirePermission(permProfitLossWrite), idempotent, createProfitLoss)
+	profitloss.Put("/:id", requirePermission(permProfitLossWrite), updateProfitLoss)
+	profitloss.Delete("/:id", requirePermission(permProfitLossWrite), deleteProfitLoss)
+
+	// ===== Ingest API (POS / akuntansi, wajib API key) =====
+	v1 := app.Group("/api/v1", apiKeyRequired, requireEntitlement(productProfitLoss), orgContext)
+	v1.Post("/ingest/profitloss", requirePermission(permProfitLossWrite), ingestProfitLoss)
 
 	// ===== Ticket CRUD =====
-	app.Post("/api/ticket/list", getAllTicket)
-	app.Get("/api/ticket/:id", getTicketByID)
-	app.Post("/api/ticket", createTicket)
-	app.Put("/api/ticket/:id", updateTicket)
-	app.Delete("/api/ticket/:id", deleteTicket)
+	ticket := app.Group("/api/ticket", authRequiredOrAPIKey, requireEntitlement(productProfitLoss), orgContext)
+	ticket.Post("/list", requirePermission(permTicketRead), getAllTicket)
+	ticket.Get("/:id", requirePermission(permTicketRead), getTicketByID)
+	ticket.Post("/", requirePermission(permTicketWrite), idempotent, createTicket)
+	ticket.Put("/:id", requirePermission(permTicketWrite), updateTicket)
+	ticket.Delete("/:id", requirePermission(permTicketWrite), deleteTicket)
 
-	// Jalankan server di port dari .env
-	appPort := getEnv("APP_PORT", "3001")
-	log.Fatal(app.Listen(":" + appPort))
+	// ===== Organizations =====
+	orgs := app.Group("/api/organizations", authRequired)
+	orgs.Get("/", getMyOrganizations)
+	orgs.Post("/", createOrganizationProcess)
+	orgs.Get("/:orgID/members", requireOrgMember(false), getOrganizationMembers)
+	// anggota baru lewat undangan (/api/invitations), tidak ditambahkan langsung
+	orgs.Put("/:orgID/members/:userID", requireOrgMember(true), updateOrganizationMember)
+	orgs.Delete("/:orgID/members/:userID", requireOrgMember(true), removeOrganizationMember)
+
+	// ===== API keys =====
+	keys := app.Group("/api/keys", authRequired, orgContext)
+	keys.Get("/", getAPIKeys)
+	keys.Post("/", createAPIKey)
+	keys.Post("/:id/rotate", rotateAPIKey)
+	keys.Delete("/:id", revokeAPIKey)
+
+	// ===== Invitations =====
+	// link accept/decline dari email (publik, token sekali pakai)
+	app.Get("/api/invitations/accept", acceptInvitationHandler)
+	app.Post("/api/invitations/accept", acceptInvitationRegisterProcess)
+	app.Get("/api/invitations/decline", declineInvitationHandler)
+	inv := app.Group("/api/invitations", authRequired, orgContext, requireOrgManage)
+	inv.Get("/", getInvitations)
+	inv.Post("/", createInvitation)
+	inv.Delete("/:id", revokeInvitation)
+
+	// ===== Admin =====
+	admin := app.Group("/api/admin", authRequired)
+	admin.Get("/outbox", requirePermission(permOutboxManage), getOutboxEmails)
+	admin.Post("/outbox/:id/retry", requirePermission(permOutboxManage), retryOutboxEmail)
+	admin.Get("/roles", requirePermission(permUsersManage), getRoles)
+	admin.Get("/users", requirePermission(permUsersManage), getAdminUsers)
+	admin.Put("/users/:id/role", requirePermission(permUsersManage), updateUserRole)
+	admin.Get("/products", requirePermission(permEntitlements), getProducts)
+	admin.Get("/users/:id/entitlements", requirePermission(permEntitlements), getUserEntitlements)
+	admin.Post("/users/:id/entitlements", requirePermission(permEntitlements), createUserEntitlement)
+	admin.Delete("/users/:id/entitlements/:entitlementID", requirePermission(permEntitlements), revokeUserEntitlement)
 }
 
 // helper ambil env dengan default
@@ -99,3 +275,12 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// helper URL dashboard (front-end), selalu diakhiri "/"
+func frontendURL() string {
+	url := getEnv("FRONTEND_URL", "https://dashboard-laba-rugi.vercel.app/")
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+	return url
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+// =======================================
+// HELPER TEST: database palsu (sqlmock)
+// =======================================
+// db global diganti selama test; query dicocokkan per potongan SQL (lihat q).
+// Statement yang tidak diharapkan langsung membuat handler gagal, jadi
+// ExpectationsWereMet juga membuktikan tidak ada tulis/baca lain.
+func newMockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = mockDB
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db = prev
+		mockDB.Close()
+	})
+	return mock
+}
+
+// pola regexp dari potongan SQL apa adanya
+func q(sqlFragment string) string {
+	return regexp.QuoteMeta(sqlFragment)
+}
+
+// =======================================
+// HELPER TEST: app Fiber
+// =======================================
+// Locals user & organisasi di-set langsung seperti hasil authRequired + orgContext,
+// supaya test handler tidak perlu mock query middleware.
+func newTestApp(userID, orgID int, orgRole string) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(localsUserID, userID)
+		if orgID != 0 {
+			c.Locals(localsOrgID, orgID)
+			c.Locals(localsOrgRole, orgRole)
+		}
+		return c.Next()
+	})
+	return app
+}
+
+// kirim request ke app, kembalikan status + body
+func doRequest(t *testing.T, app *fiber.App, method, path, body string, headers ...string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+// =======================================
+// HELPER TEST: konfigurasi token
+// =======================================
+// initTokenConfig tidak dipanggil di test; secret + TTL diisi supaya token yang terbit bisa di-parse
+func setTestTokenConfig(t *testing.T) {
+	t.Helper()
+	prevSecret, prevAccess, prevRefresh := tokenSecret, accessTokenTTL, refreshTokenTTL
+	tokenSecret = []byte("test-secret")
+	accessTokenTTL, refreshTokenTTL = 15*time.Minute, 24*time.Hour
+	t.Cleanup(func() {
+		tokenSecret, accessTokenTTL, refreshTokenTTL = prevSecret, prevAccess, prevRefresh
+	})
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Migrasi dijalankan berurutan dan dicatat di schema_migrations,
+// jadi setiap migrasi hanya jalan sekali. Tabel lama (users,
+// profit_losses, tickets) tidak dibuat di sini.
+type migration struct {
+	id    string
+	stmts []string
+	// check (opsional) dijalankan sebelum stmts; error = migrasi dibatalkan, tidak ada yang diubah
+	check func() error
+}
+
+var migrations = []migration{
+	{
+		id: "0001_create_refresh_tokens",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id BIGINT UNSIGNED NOT NULL,
+				family_id CHAR(32) NOT NULL,
+				token_hash CHAR(64) NOT NULL,
+				user_agent VARCHAR(255) NOT NULL DEFAULT '',
+				ip_address VARCHAR(45) NOT NULL DEFAULT '',
+				expires_at DATETIME NOT NULL,
+				revoked_at DATETIME NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY uq_refresh_tokens_hash (token_hash),
+				KEY idx_refresh_tokens_user (user_id),
+				KEY idx_refresh_tokens_family (family_id)
+			)`,
+		},
+	},
+	{
+		id: "0002_create_user_tokens",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS user_tokens (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id BIGINT UNSIGNED NOT NULL,
+				purpose VARCHAR(32) NOT NULL,
+				token_hash CHAR(64) NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE KEY uq_user_tokens_hash (token_hash),
+				KEY idx_user_tokens_user_purpose (user_id, purpose, created_at)
+			)`,
+		},
+	},
+	{
+		id: "0003_create_email_outbox",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS email_outbox (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				to_address VARCHAR(255) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				body_text MEDIUMTEXT NOT NULL,
+				status VARCHAR(16) NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				max_attempts INT NOT NULL,
+				next_attempt_at DATETIME NOT NULL,
+				last_error TEXT NULL,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL,
+				sent_at DATETIME NULL,
+				KEY idx_email_outbox_status_next (status, next_attempt_at)
+			)`,
+		},
+	},
+	{
+		id: "0004_add_email_locale_and_html",
+		stmts: []string{
+			"ALTER TABLE users ADD COLUMN locale VARCHAR(5) NOT NULL DEFAULT 'id'",
+			"ALTER TABLE email_outbox ADD COLUMN body_html MEDIUMTEXT NULL AFTER body_text",
+		},
+	},
+	{
+		id: "0005_create_login_attempts_and_audit_log",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS login_attempts (
+				throttle_key VARCHAR(320) NOT NULL PRIMARY KEY,
+				failures INT NOT NULL DEFAULT 0,
+				last_failed_at DATETIME NOT NULL,
+				blocked_until DATETIME NOT NULL
+			)`, `
+			CREATE TABLE IF NOT EXISTS auth_audit_log (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id BIGINT UNSIGNED NULL,
+				email VARCHAR(255) NOT NULL DEFAULT '',
+				ip_address VARCHAR(45) NOT NULL DEFAULT '',
+				event VARCHAR(64) NOT NULL,
+				created_at DATETIME NOT NULL,
+				KEY idx_auth_audit_log_user (user_id),
+				KEY idx_auth_audit_log_created (created_at)
+			)`,
+		},
+	},
+	{
+		id: "0006_create_two_factor",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS user_two_factor (
+				user_id BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+				secret VARCHAR(64) NOT NULL,
+				confirmed_at DATETIME NULL,
+				last_used_step BIGINT NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL
+			)`, `
+			CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id BIGINT UNSIGNED NOT NULL,
+				code_hash CHAR(64) NOT NULL,
+				used_at DATETIME NULL,
+				created_at DATETIME NOT NULL,
+				KEY idx_two_factor_recovery_codes_user (user_id)
+			)`,
+		},
+	},
+	{
+		id: "0007_create_roles_and_permissions",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS roles (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL
+			)`, `
+			CREATE TABLE IF NOT EXISTS permissions (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(64) NOT NULL,
+				UNIQUE KEY uq_permissions_name (name)
+			)`, `
+			CREATE TABLE IF NOT EXISTS role_permissions (
+				role_id BIGINT UNSIGNED NOT NULL,
+				permission_id BIGINT UNSIGNED NOT NULL,
+				PRIMARY KEY (role_id, permission_id)
+			)`,
+			`INSERT IGNORE INTO roles (id, name) VALUES
+				(1, 'superadmin'), (2, 'admin'), (3, 'member'), (4, 'viewer')`,
+			`INSERT IGNORE INTO permissions (name) VALUES
+				('profitloss.read'), ('profitloss.write'), ('ticket.read'), ('ticket.write'),
+				('users.manage'), ('outbox.manage')`,
+			// superadmin: semua permission
+			`INSERT IGNORE INTO role_permissions (role_id, permission_id)
+				SELECT 1, id FROM permissions`,
+			`INSERT IGNORE INTO role_permissions (role_id, permission_id)
+				SELECT 2, id FROM permissions
+				WHERE name IN ('profitloss.read', 'profitloss.write', 'ticket.read', 'ticket.write')`,
+			`INSERT IGNORE INTO role_permissions (role_id, permission_id)
+				SELECT 3, id FROM permissions
+				WHERE name IN ('profitloss.read', 'profitloss.write', 'ticket.read', 'ticket.write')`,
+			`INSERT IGNORE INTO role_permissions (role_id, permission_id)
+				SELECT 4, id FROM permissions
+				WHERE name IN ('profitloss.read', 'ticket.read')`,
+		},
+	},
+	{
+		id: "0008_create_products_and_entitlements",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS products (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				code VARCHAR(64) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				UNIQUE KEY uq_products_code (code)
+			)`, `
+			CREATE TABLE IF NOT EXISTS user_product_entitlements (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id BIGINT UNSIGNED NOT NULL,
+				product_id BIGINT UNSIGNED NOT NULL,
+				starts_at DATETIME NOT NULL,
+				expires_at DATETIME NULL,
+				revoked_at DATETIME NULL,
+				granted_by BIGINT UNSIGNED NULL,
+				created_at DATETIME NOT NULL,
+				KEY idx_entitlements_user_product (user_id, product_id)
+			)`,
+			`INSERT IGNORE INTO products (id, code, name) VALUES (1, 'profitloss', 'Dashboard Laba Rugi')`,
+			// pindahkan kolom boolean lama ke entitlement
+			`INSERT INTO user_product_entitlements (user_id, product_id, starts_at, created_at)
+				SELECT id, 1, UTC_TIMESTAMP(), UTC_TIMESTAMP() FROM users WHERE access_to_product_1 = 1`,
+			`INSERT IGNORE INTO permissions (name) VALUES ('entitlements.manage')`,
+			`INSERT IGNORE INTO role_permissions (role_id, permission_id)
+				SELECT 1, id FROM permissions WHERE name = 'entitlements.manage'`,
+		},
+	},
+	{
+		id: "0009_create_organizations",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS organizations (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(255) NOT NULL,
+				created_by BIGINT UNSIGNED NULL,
+				created_at DATETIME NOT NULL
+			)`, `
+			CREATE TABLE IF NOT EXISTS organization_members (
+				organization_id BIGINT UNSIGNED NOT NULL,
+				user_id BIGINT UNSIGNED NOT NULL,
+				role VARCHAR(16) NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (organization_id, user_id),
+				KEY idx_organization_members_user (user_id)
+			)`,
+			"ALTER TABLE profit_losses ADD COLUMN organization_id BIGINT UNSIGNED NULL AFTER user_id, ADD KEY idx_profit_losses_org_date (organization_id, date)",
+			"ALTER TABLE tickets ADD COLUMN organization_id BIGINT UNSIGNED NULL AFTER user_id, ADD KEY idx_tickets_org (organization_id)",
+			// satu organisasi per user lama (dari kolom users.organization), user jadi owner
+			`INSERT INTO organizations (name, created_by, created_at)
+				SELECT COALESCE(NULLIF(organization, ''), name), id, UTC_TIMESTAMP() FROM users`,
+			`INSERT INTO organization_members (organization_id, user_id, role, created_at)
+				SELECT id, created_by, 'owner', UTC_TIMESTAMP() FROM organizations`,
+			`UPDATE profit_losses pl JOIN organizations o ON o.created_by = pl.user_id
+				SET pl.organization_id = o.id`,
+			`UPDATE tickets t JOIN organizations o ON o.created_by = t.user_id
+				SET t.organization_id = o.id`,
+		},
+	},
+	{
+		id: "0010_create_organization_invitations",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS organization_invitations (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				organization_id BIGINT UNSIGNED NOT NULL,
+				email VARCHAR(255) NOT NULL,
+				role VARCHAR(16) NOT NULL,
+				token_hash CHAR(64) NOT NULL,
+				invited_by BIGINT UNSIGNED NOT NULL,
+				expires_at DATETIME NOT NULL,
+				accepted_at DATETIME NULL,
+				declined_at DATETIME NULL,
+				revoked_at DATETIME NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE KEY uq_organization_invitations_token (token_hash),
+				KEY idx_organization_invitations_org_email (organization_id, email)
+			)`,
+		},
+	},
+	{
+		id: "0011_create_api_keys",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS api_keys (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				user_id BIGINT UNSIGNED NOT NULL,
+				organization_id BIGINT UNSIGNED NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				prefix VARCHAR(16) NOT NULL,
+				key_hash CHAR(64) NOT NULL,
+				scopes VARCHAR(255) NOT NULL,
+				last_used_at DATETIME NULL,
+				revoked_at DATETIME NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE KEY uq_api_keys_hash (key_hash),
+				KEY idx_api_keys_user (user_id)
+			)`,
+			// app_key lama dipindah ke api_keys sebagai key "legacy" (hash dari "<user_id>:<app_key>",
+			// lihat legacyAppKey) supaya integrasi lama tetap jalan, baru kolom plaintext-nya dihapus
+			`INSERT INTO api_keys (user_id, organization_id, name, prefix, key_hash, scopes, created_at)
+				SELECT u.id, (SELECT MIN(o.id) FROM organizations o WHERE o.created_by = u.id),
+					'legacy app_key', 'legacy', SHA2(CONCAT(u.id, ':', u.app_key), 256),
+					'profitloss:write,tickets', UTC_TIMESTAMP()
+				FROM users u
+				WHERE u.app_key IS NOT NULL AND u.app_key <> ''
+					AND EXISTS (SELECT 1 FROM organizations o WHERE o.created_by = u.id)`,
+			"ALTER TABLE users DROP COLUMN app_key",
+		},
+	},
+	{
+		id:    "0012_unique_profit_losses_org_date",
+		check: checkDuplicateProfitLossDates,
+		stmts: []string{
+			// satu baris per organisasi per tanggal (dipakai upsert ingest)
+			"ALTER TABLE profit_losses DROP KEY idx_profit_losses_org_date, ADD UNIQUE KEY uq_profit_losses_org_date (organization_id, date)",
+		},
+	},
+	{
+		id: "0013_create_idempotency_keys",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS idempotency_keys (
+				user_id BIGINT UNSIGNED NOT NULL,
+				idem_key VARCHAR(255) NOT NULL,
+				request_hash CHAR(64) NOT NULL,
+				status_code SMALLINT NOT NULL DEFAULT 0,
+				response_body MEDIUMBLOB NULL,
+				expires_at DATETIME NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (user_id, idem_key),
+				KEY idx_idempotency_keys_expires (expires_at)
+			)`,
+		},
+	},
+	{
+		id: "0014_add_user_tokens_data",
+		stmts: []string{
+			// data tambahan token, mis. email baru untuk purpose change_email
+			"ALTER TABLE user_tokens ADD COLUMN data VARCHAR(255) NOT NULL DEFAULT '' AFTER token_hash",
+		},
+	},
+	{
+		id: "0015_add_users_delete_after",
+		stmts: []string{
+			// terisi setelah user konfirmasi hapus akun; dipurge worker setelah lewat
+			"ALTER TABLE users ADD COLUMN delete_after DATETIME NULL, ADD KEY idx_users_delete_after (delete_after)",
+		},
+	},
+	{
+		id: "0016_create_categories_and_items",
+		stmts: []string{`
+			CREATE TABLE IF NOT EXISTS categories (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				organization_id BIGINT UNSIGNED NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				type VARCHAR(16) NOT NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE KEY uq_categories_org_type_name (organization_id, type, name)
+			)`, `
+			CREATE TABLE IF NOT EXISTS profit_loss_items (
+				id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+				profit_loss_id BIGINT UNSIGNED NOT NULL,
+				category_id BIGINT UNSIGNED NOT NULL,
+				amount DECIMAL(15,2) NOT NULL,
+				note VARCHAR(255) NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				KEY idx_profit_loss_items_pl (profit_loss_id),
+				KEY idx_profit_loss_items_category (category_id)
+			)`,
+		},
+	},
+	{
+		id: "0017_add_users_token_version",
+		stmts: []string{
+			// ikut di claim "ver" access token; dinaikkan saat reset password / logout semua perangkat
+			"ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0",
+		},
+	},
+	{
+		id: "0018_revoke_admin_users_manage",
+		stmts: []string{
+			// users.manage bersifat global (lintas organisasi), hanya superadmin
+			`DELETE rp FROM role_permissions rp
+				JOIN permissions p ON p.id = rp.permission_id
+				WHERE rp.role_id = 2 AND p.name = 'users.manage'`,
+		},
+	},
+	{
+		id: "0019_add_idempotency_keys_locked_until",
+		stmts: []string{
+			// lease request yang sedang diproses (status_code = 0), lihat idempotencyLease
+			"ALTER TABLE idempotency_keys ADD COLUMN locked_until DATETIME NULL AFTER status_code",
+		},
+	},
+}
+
+// =======================================
+// MIGRATE
+// =======================================
+func migrate() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			id VARCHAR(100) PRIMARY KEY,
+			applied_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		var applied string
+		err := db.QueryRow("SELECT id FROM schema_migrations WHERE id = ?", m.id).Scan(&applied)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		if m.check != nil {
+			if err := m.check(); err != nil {
+				return fmt.Errorf("%s: %w", m.id, err)
+			}
+		}
+		for _, stmt := range m.stmts {
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("%s: %w", m.id, err)
+			}
+		}
+
+		if _, err := db.Exec("INSERT INTO schema_migrations (id, applied_at) VALUES (?, ?)", m.id, time.Now()); err != nil {
+			return err
+		}
+		log.Println("migrated:", m.id)
+	}
+	return nil
+}
+
+// =======================================
+// CHECK: duplikat profit_losses sebelum UNIQUE (organization_id, date)
+// =======================================
+// Data lama bisa punya beberapa baris di tanggal yang sama. Tidak digabung otomatis
+// (belum tentu dobel input), jadi migrasi berhenti dengan daftar baris yang perlu dibereskan.
+func checkDuplicateProfitLossDates() error {
+	rows, err := db.Query(`
+		SELECT organization_id, date, COUNT(*), GROUP_CONCAT(id ORDER BY id)
+		FROM profit_losses
+		GROUP BY organization_id, date
+		HAVING COUNT(*) > 1
+		ORDER BY organization_id, date
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		lines []string
+		total int
+	)
+	for rows.Next() {
+		var (
+			orgID sql.NullInt64
+			date  string
+			count int
+			ids   string
+		)
+		if err := rows.Scan(&orgID, &date, &count, &ids); err != nil {
+			return err
+		}
+		total++
+		if len(lines) < 20 {
+			lines = append(lines, fmt.Sprintf("  organization_id=%d date=%s rows=%d ids=%s", orgID.Int64, date, count, ids))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%d (organization_id, date) pairs in profit_losses have more than one row; "+
+			"merge or delete the duplicates so each organization has one row per date, then restart:\n%s",
+		total, strings.Join(lines, "\n"),
+	)
+}
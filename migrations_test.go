@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCheckDuplicateProfitLossDates(t *testing.T) {
+	cols := []string{"organization_id", "date", "count", "ids"}
+
+	t.Run("no duplicates", func(t *testing.T) {
+		mock := newMockDB(t)
+		mock.ExpectQuery(q("HAVING COUNT(*) > 1")).WillReturnRows(sqlmock.NewRows(cols))
+		if err := checkDuplicateProfitLossDates(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("duplicates abort with the rows to fix", func(t *testing.T) {
+		mock := newMockDB(t)
+		mock.ExpectQuery(q("HAVING COUNT(*) > 1")).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(10, "2025-01-01", 2, "7,9"))
+		err := checkDuplicateProfitLossDates()
+		if err == nil || !strings.Contains(err.Error(), "organization_id=10 date=2025-01-01 rows=2 ids=7,9") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+}
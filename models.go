@@ -12,22 +12,41 @@ type User struct {
 	Email            string `json:"email"`
 	Organization     string `json:"organization"`
 	Whatsapp         string `json:"whatsapp"`
-	AccessToProduct1 bool   `json:"access_to_product_1"`
-	AppKey           string `json:"app_key"`
+	Locale           string `json:"locale"`
+	AccessToProduct1 bool   `json:"access_to_product_1"` // dari entitlement produk ini
 }
 
 type ProfitLoss struct {
-	ID         int     `json:"id"`
-	UserID     int     `json:"user_id"`
-	Date       string  `json:"date"`
-	Revenue    float64 `json:"revenue"`
-	Expense    float64 `json:"expense"`
-	ProfitLoss float64 `json:"profitloss"`
-	AppKey     string  `json:"app_key"`
+	ID             int     `json:"id"`
+	UserID         int     `json:"user_id"`
+	OrganizationID int     `json:"organization_id"`
+	Date           string  `json:"date"`
+	Revenue        float64 `json:"revenue"`
+	Expense        float64 `json:"expense"`
+	ProfitLoss     float64 `json:"profitloss"`
+
+	// opsional: kalau diisi, revenue/expense dihitung dari item
+	Items []ProfitLossItem `json:"items,omitempty"`
+}
+
+// filter + paging untuk /api/profitloss/list (body JSON atau query string)
+type ProfitLossListRequest struct {
+	Cursor      string   `json:"cursor" query:"cursor"`
+	Limit       int      `json:"limit" query:"limit"`
+	From        string   `json:"from" query:"from"` // YYYY-MM-DD, inklusif
+	To          string   `json:"to" query:"to"`     // YYYY-MM-DD, inklusif
+	AmountField string   `json:"amount_field" query:"amount_field"`
+	MinAmount   *float64 `json:"min_amount" query:"min_amount"`
+	MaxAmount   *float64 `json:"max_amount" query:"max_amount"`
+	Sort        string   `json:"sort" query:"sort"`
+	Direction   string   `json:"direction" query:"direction"`
 }
 
+// range + granularity untuk /api/profitloss/stats (semua opsional)
 type StatsRequest struct {
-	UserID int `json:"user_id"`
+	From        string `json:"from" query:"from"` // YYYY-MM-DD, inklusif
+	To          string `json:"to" query:"to"`     // YYYY-MM-DD, inklusif
+	Granularity string `json:"granularity" query:"granularity"`
 }
 
 type UserRequest struct {
@@ -35,12 +54,12 @@ type UserRequest struct {
 }
 
 type Ticket struct {
-	ID          int    `json:"id"`
-	UserID      int    `json:"user_id"`
-	ProductID   int    `json:"product_id"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-	AppKey      string `json:"app_key"` // dari front-end
+	ID             int    `json:"id"`
+	UserID         int    `json:"user_id"`
+	OrganizationID int    `json:"organization_id"`
+	ProductID      int    `json:"product_id"`
+	Description    string `json:"description"`
+	Status         string `json:"status"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
 }
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Role anggota di dalam organisasi (organization_members.role)
+const (
+	orgRoleOwner  = "owner"
+	orgRoleAdmin  = "admin"
+	orgRoleMember = "member"
+	orgRoleViewer = "viewer"
+)
+
+// key untuk c.Locals
+const (
+	localsOrgID   = "orgID"
+	localsOrgRole = "orgRole"
+)
+
+// permission yang juga dibatasi oleh role di organisasi aktif
+var orgRolePermissions = map[string]map[string]bool{
+	orgRoleOwner: {
+		permProfitLossRead: true, permProfitLossWrite: true,
+		permTicketRead: true, permTicketWrite: true, permMembersManage: true,
+	},
+	orgRoleAdmin: {
+		permProfitLossRead: true, permProfitLossWrite: true,
+		permTicketRead: true, permTicketWrite: true, permMembersManage: true,
+	},
+	orgRoleMember: {
+		permProfitLossRead: true, permProfitLossWrite: true,
+		permTicketRead: true, permTicketWrite: true,
+	},
+	orgRoleViewer: {
+		permProfitLossRead: true, permTicketRead: true,
+	},
+}
+
+var orgScopedPermissions = map[string]bool{
+	permProfitLossRead: true, permProfitLossWrite: true,
+	permTicketRead: true, permTicketWrite: true,
+}
+
+var errLastOwner = errors.New("organization must have at least one owner")
+
+type Organization struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type OrganizationMember struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+func validOrgRole(role string) bool {
+	_, ok := orgRolePermissions[role]
+	return ok
+}
+
+// =======================================
+// HELPER: buat organisasi + owner
+// =======================================
+func createOrganization(ex execer, name string, ownerID int) (int, error) {
+	now := time.Now()
+	res, err := ex.Exec(
+		"INSERT INTO organizations (name, created_by, created_at) VALUES (?, ?, ?)",
+		name, ownerID, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	orgID, _ := res.LastInsertId()
+
+	if err := addOrganizationMember(ex, int(orgID), ownerID, orgRoleOwner); err != nil {
+		return 0, err
+	}
+	return int(orgID), nil
+}
+
+func addOrganizationMember(ex execer, orgID, userID int, role string) error {
+	_, err := ex.Exec(
+		"INSERT INTO organization_members (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)",
+		orgID, userID, role, time.Now(),
+	)
+	return err
+}
+
+// role user di organisasi ("" kalau bukan anggota)
+func orgMemberRole(orgID, userID int) (string, error) {
+	var role string
+	err := db.QueryRow(
+		"SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, userID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// =======================================
+// MIDDLEWARE: organisasi aktif
+// =======================================
+// Header X-Organization-ID; kalau kosong pakai organisasi pertama user (owner didahulukan).
+// Request dengan API key selalu memakai organisasi tempat key dibuat.
+func orgContext(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+
+	var (
+		orgID int
+		role  string
+		err   error
+	)
+	if key := currentAPIKey(c); key != nil {
+		orgID = key.orgID
+		role, err = orgMemberRole(orgID, userID)
+	} else if header := c.Get("X-Organization-ID"); header != "" {
+		orgID = atoi(header)
+		role, err = orgMemberRole(orgID, userID)
+	} else {
+		err = db.QueryRow(`
+			SELECT organization_id, role
+			FROM organization_members
+			WHERE user_id = ?
+			ORDER BY role = 'owner' DESC, organization_id
+			LIMIT 1
+		`, userID).Scan(&orgID, &role)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if role == "" {
+		return c.Status(403).JSON(fiber.Map{"error": "not a member of this organization"})
+	}
+
+	c.Locals(localsOrgID, orgID)
+	c.Locals(localsOrgRole, role)
+	return c.Next()
+}
+
+// helper ambil organisasi aktif hasil orgContext
+func currentOrgID(c *fiber.Ctx) int {
+	id, _ := c.Locals(localsOrgID).(int)
+	return id
+}
+
+// =======================================
+// LIST organisasi milik user
+// =======================================
+func getMyOrganizations(c *fiber.Ctx) error {
+	rows, err := db.Query(`
+		SELECT o.id, o.name, m.role
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = ?
+		ORDER BY o.name
+	`, currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var orgs []Organization
+	for rows.Next() {
+		var o Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.Role); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		orgs = append(orgs, o)
+	}
+	return c.JSON(orgs)
+}
+
+// =======================================
+// CREATE organisasi (pembuat jadi owner)
+// =======================================
+func createOrganizationProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Name string `json:"name"`
+	})
+	if err := c.BodyParser(req); err != nil || strings.TrimSpace(req.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	orgID, err := createOrganization(tx, strings.TrimSpace(req.Name), currentUserID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(Organization{ID: orgID, Name: strings.TrimSpace(req.Name), Role: orgRoleOwner})
+}
+
+// =======================================
+// MIDDLEWARE: role minimal di organisasi :orgID
+// =======================================
+func requireOrgMember(manage bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		orgID := atoi(c.Params("orgID"))
+		role, err := orgMemberRole(orgID, currentUserID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if role == "" {
+			// bukan anggota: anggap organisasi tidak ada
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		if manage && !orgRolePermissions[role][permMembersManage] {
+			return c.Status(403).JSON(fiber.Map{"error": "forbidden"})
+		}
+		c.Locals(localsOrgID, orgID)
+		c.Locals(localsOrgRole, role)
+		return c.Next()
+	}
+}
+
+// =======================================
+// MIDDLEWARE: boleh kelola anggota di organisasi aktif
+// =======================================
+// dipasang setelah orgContext
+func requireOrgManage(c *fiber.Ctx) error {
+	role, _ := c.Locals(localsOrgRole).(string)
+	if !orgRolePermissions[role][permMembersManage] {
+		return c.Status(403).JSON(fiber.Map{"error": "forbidden", "permission": permMembersManage})
+	}
+	return c.Next()
+}
+
+// =======================================
+// LIST anggota organisasi
+// =======================================
+func getOrganizationMembers(c *fiber.Ctx) error {
+	rows, err := db.Query(`
+		SELECT u.id, u.name, u.email, m.role
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = ?
+		ORDER BY u.name
+	`, currentOrgID(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var members []OrganizationMember
+	for rows.Next() {
+		var m OrganizationMember
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.Role); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		members = append(members, m)
+	}
+	return c.JSON(members)
+}
+
+// =======================================
+// UPDATE role anggota
+// =======================================
+func updateOrganizationMember(c *fiber.Ctx) error {
+	req := new(struct {
+		Role string `json:"role"`
+	})
+	if err := c.BodyParser(req); err != nil || !validOrgRole(req.Role) {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	orgID := currentOrgID(c)
+	userID := atoi(c.Params("userID"))
+
+	current, err := orgMemberRole(orgID, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if current == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	if (req.Role == orgRoleOwner || current == orgRoleOwner) && c.Locals(localsOrgRole) != orgRoleOwner {
+		return c.Status(403).JSON(fiber.Map{"error": "only owner can manage owners"})
+	}
+	if current == orgRoleOwner && req.Role != orgRoleOwner {
+		if err := ensureAnotherOwner(orgID, userID); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	_, err = db.Exec(
+		"UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?",
+		req.Role, orgID, userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "member updated", "user_id": userID, "role": req.Role})
+}
+
+// =======================================
+// REMOVE anggota
+// =======================================
+func removeOrganizationMember(c *fiber.Ctx) error {
+	orgID := currentOrgID(c)
+	userID := atoi(c.Params("userID"))
+
+	current, err := orgMemberRole(orgID, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if current == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "not found"})
+	}
+	if current == orgRoleOwner {
+		if c.Locals(localsOrgRole) != orgRoleOwner {
+			return c.Status(403).JSON(fiber.Map{"error": "only owner can remove owners"})
+		}
+		if err := ensureAnotherOwner(orgID, userID); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	_, err = db.Exec("DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "member removed"})
+}
+
+// organisasi harus selalu punya minimal satu owner
+func ensureAnotherOwner(orgID, userID int) error {
+	var owners int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = ? AND user_id <> ?",
+		orgID, orgRoleOwner, userID,
+	).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+// app dengan route asli (authRequiredOrAPIKey -> requireEntitlement -> orgContext -> handler)
+func newRoutedApp() *fiber.App {
+	app := fiber.New()
+	setupRoutes(app)
+	return app
+}
+
+// User B login dengan access token lalu memilih organisasi A lewat X-Organization-ID:
+// orgContext harus menolak (403) sebelum handler jalan, jadi tidak ada query ke baris id 7.
+func TestCrossTenantOrganizationHeader(t *testing.T) {
+	setTestTokenConfig(t)
+	token, _, err := signToken(tenantUserB, tokenTypeAccess, 0, accessTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", "/api/profitloss/7", ""},
+		{"PUT", "/api/profitloss/7", `{"date":"2025-01-02","revenue":1000,"expense":0}`},
+		{"DELETE", "/api/profitloss/7", ""},
+		{"GET", "/api/ticket/7", ""},
+		{"PUT", "/api/ticket/7", `{"description":"diambil alih"}`},
+		{"DELETE", "/api/ticket/7", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			mock := newMockDB(t)
+			mock.ExpectQuery(q("SELECT token_version FROM users WHERE id = ?")).
+				WithArgs(tenantUserB).
+				WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(0))
+			mock.ExpectQuery(q("FROM user_product_entitlements")).
+				WithArgs(tenantUserB, productProfitLoss, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(q("SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?")).
+				WithArgs(tenantOrgA, tenantUserB).
+				WillReturnRows(sqlmock.NewRows([]string{"role"}))
+
+			resp, body := doRequest(t, newRoutedApp(), tt.method, tt.path, tt.body,
+				fiber.HeaderAuthorization, "Bearer "+token,
+				"X-Organization-ID", fmt.Sprint(tenantOrgA))
+			if resp.StatusCode != 403 {
+				t.Fatalf("status = %d, want 403 (body %s)", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+// API key organisasi B + X-Organization-ID organisasi A: header diabaikan, key tetap
+// terikat ke organisasi B, jadi baris milik A tidak ditemukan (404).
+func TestCrossTenantAPIKeyIgnoresOrganizationHeader(t *testing.T) {
+	const rawKey = apiKeyPrefix + "kunci-org-b"
+
+	tests := []struct {
+		path, table string
+		columns     []string
+	}{
+		{"/api/profitloss/7", "profit_losses", []string{"id", "user_id", "organization_id", "date", "revenue", "expense", "profitloss"}},
+		{"/api/ticket/7", "tickets", []string{"id", "user_id", "organization_id", "product_id", "description", "status", "created_at", "updated_at"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			mock := newMockDB(t)
+			mock.ExpectQuery(q("FROM api_keys k")).
+				WithArgs(hashToken(rawKey)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "scopes"}).
+					AddRow(3, tenantUserB, tenantOrgB, scopeProfitLossRead+","+scopeTickets))
+			mock.ExpectExec(q("UPDATE api_keys SET last_used_at = ?")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(q("FROM user_product_entitlements")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(q("SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?")).
+				WithArgs(tenantOrgB, tenantUserB).
+				WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(orgRoleOwner))
+			mock.ExpectQuery(q("JOIN role_permissions rp")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(q("FROM "+tt.table+" WHERE id = ? AND organization_id = ?")).
+				WithArgs("7", tenantOrgB).
+				WillReturnRows(sqlmock.NewRows(tt.columns))
+
+			resp, body := doRequest(t, newRoutedApp(), "GET", tt.path, "",
+				fiber.HeaderAuthorization, "Bearer "+rawKey,
+				"X-Organization-ID", fmt.Sprint(tenantOrgA))
+			if resp.StatusCode != 404 {
+				t.Fatalf("status = %d, want 404 (body %s)", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+// tanpa entitlement produk, route tiket ditolak sebelum organisasi / handler dicek
+func TestTicketRequiresEntitlement(t *testing.T) {
+	setTestTokenConfig(t)
+	token, _, err := signToken(tenantUserB, tokenTypeAccess, 0, accessTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		t.Run(method, func(t *testing.T) {
+			mock := newMockDB(t)
+			mock.ExpectQuery(q("SELECT token_version FROM users WHERE id = ?")).
+				WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(0))
+			mock.ExpectQuery(q("FROM user_product_entitlements")).
+				WithArgs(tenantUserB, productProfitLoss, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+			resp, body := doRequest(t, newRoutedApp(), method, "/api/ticket/7", `{"description":"x"}`,
+				fiber.HeaderAuthorization, "Bearer "+token)
+			if resp.StatusCode != 403 {
+				t.Fatalf("status = %d, want 403 (body %s)", resp.StatusCode, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Status email di email_outbox
+const (
+	outboxPending = "pending"
+	outboxSending = "sending"
+	outboxSent    = "sent"
+	outboxDead    = "dead"
+)
+
+const (
+	outboxMaxAttempts  = 8
+	outboxBatchSize    = 20
+	outboxBaseBackoff  = 30 * time.Second
+	outboxMaxBackoff   = 6 * time.Hour
+	outboxStuckTimeout = 10 * time.Minute
+)
+
+type OutboxEmail struct {
+	ID            int    `json:"id"`
+	To            string `json:"to"`
+	Subject       string `json:"subject"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	MaxAttempts   int    `json:"max_attempts"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	LastError     string `json:"last_error"`
+	CreatedAt     string `json:"created_at"`
+	SentAt        string `json:"sent_at"`
+}
+
+// =======================================
+// ENQUEUE: simpan email, dikirim worker
+// =======================================
+// ex bisa *sql.Tx supaya email ikut ter-commit bersama data lainnya
+func enqueueEmail(ex execer, msg Message) error {
+	now := time.Now()
+	_, err := ex.Exec(`
+		INSERT INTO email_outbox (to_address, subject, body_text, body_html, status, attempts, max_attempts, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+	`, msg.To, msg.Subject, msg.Text, msg.HTML, outboxPending, outboxMaxAttempts, now, now, now)
+	return err
+}
+
+// =======================================
+// WORKER
+// =======================================
+func startOutboxWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := processOutbox(); err != nil {
+				log.Println("outbox:", err)
+			}
+		}
+	}()
+}
+
+func processOutbox() error {
+	now := time.Now()
+
+	// email yang "sending" terlalu lama (proses mati di tengah jalan) dikembalikan ke antrian
+	_, err := db.Exec(
+		"UPDATE email_outbox SET status = ?, updated_at = ? WHERE status = ? AND updated_at < ?",
+		outboxPending, now, outboxSending, now.Add(-outboxStuckTimeout),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT id FROM email_outbox
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY id
+		LIMIT ?
+	`, outboxPending, now, outboxBatchSize)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := deliverOutboxEmail(id); err != nil {
+			log.Println("outbox: email", id, ":", err)
+		}
+	}
+	return nil
+}
+
+func deliverOutboxEmail(id int) error {
+	// klaim baris; kalau instance lain sudah ambil, lewati
+	err := execOwned(
+		"UPDATE email_outbox SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+		outboxSending, time.Now(), id, outboxPending,
+	)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var (
+		msg         Message
+		attempts    int
+		maxAttempts int
+	)
+	err = db.QueryRow(
+		"SELECT to_address, subject, body_text, COALESCE(body_html, ''), attempts, max_attempts FROM email_outbox WHERE id = ?", id,
+	).Scan(&msg.To, &msg.Subject, &msg.Text, &msg.HTML, &attempts, &maxAttempts)
+	if err != nil {
+		return err
+	}
+
+	sendErr := mailer.Send(msg)
+	now := time.Now()
+	attempts++
+
+	if sendErr == nil {
+		_, err = db.Exec(
+			"UPDATE email_outbox SET status = ?, attempts = ?, sent_at = ?, updated_at = ?, last_error = NULL WHERE id = ?",
+			outboxSent, attempts, now, now, id,
+		)
+		return err
+	}
+
+	// gagal: jadwalkan ulang dengan backoff, atau dead-letter kalau sudah habis jatah
+	status := outboxPending
+	if attempts >= maxAttempts {
+		status = outboxDead
+	}
+	_, err = db.Exec(
+		"UPDATE email_outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ? WHERE id = ?",
+		status, attempts, now.Add(outboxBackoff(attempts)), sendErr.Error(), now, id,
+	)
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// backoff eksponensial: 30s, 1m, 2m, 4m, ... maksimal 6 jam
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return d
+}
+
+// =======================================
+// ADMIN: list email outbox
+// =======================================
+func getOutboxEmails(c *fiber.Ctx) error {
+	status := c.Query("status", outboxDead)
+
+	rows, err := db.Query(`
+		SELECT id, to_address, subject, status, attempts, max_attempts, next_attempt_at,
+			COALESCE(last_error, ''), created_at, COALESCE(sent_at, '')
+		FROM email_outbox
+		WHERE status = ?
+		ORDER BY id DESC
+		LIMIT 200
+	`, status)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var emails []OutboxEmail
+	for rows.Next() {
+		var e OutboxEmail
+		if err := rows.Scan(&e.ID, &e.To, &e.Subject, &e.Status, &e.Attempts, &e.MaxAttempts,
+			&e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.SentAt); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		emails = append(emails, e)
+	}
+	return c.JSON(emails)
+}
+
+// =======================================
+// ADMIN: retry email yang gagal
+// =======================================
+func retryOutboxEmail(c *fiber.Ctx) error {
+	id := c.Params("id")
+	now := time.Now()
+
+	err := execOwned(`
+		UPDATE email_outbox
+		SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, outboxPending, now, now, id, outboxDead)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found or not in dead state"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "email queued for retry"})
+}
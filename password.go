@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// masa berlaku link reset password
+const passwordResetTokenTTL = time.Hour
+
+// =======================================
+// FORGOT PASSWORD (kirim link reset)
+// =======================================
+func forgotPasswordProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Email string `json:"email"`
+	})
+	if err := c.BodyParser(req); err != nil || req.Email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	// response sama untuk email terdaftar/tidak, supaya tidak bisa dipakai cek email
+	okResponse := fiber.Map{"message": "if the account exists, a password reset link has been sent"}
+
+	var (
+		userID int
+		name   string
+		locale string
+	)
+	err := db.QueryRow("SELECT id, name, locale FROM users WHERE email = ? LIMIT 1", req.Email).Scan(&userID, &name, &locale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.JSON(okResponse)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	throttled, err := userTokenThrottled(userID, purposePasswordReset, time.Minute, 5)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if throttled {
+		c.Set(fiber.HeaderRetryAfter, "60")
+		return c.Status(429).JSON(fiber.Map{"error": "too many requests, please wait before requesting another email"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	token, err := createUserToken(tx, userID, purposePasswordReset, passwordResetTokenTTL)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	msg, err := passwordResetEmail(req.Email, name, locale, passwordResetLink(token))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(okResponse)
+}
+
+// =======================================
+// RESET PASSWORD (pakai token dari email)
+// =======================================
+func resetPasswordProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	})
+	if err := c.BodyParser(req); err != nil || req.Token == "" || req.NewPassword == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, purposePasswordReset, req.Token)
+	if err != nil {
+		if err == errUserTokenInvalid {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid or expired reset link"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// policy dicek setelah token valid (butuh email & nama); kalau gagal token tidak terpakai (rollback)
+	var email, name string
+	if err := tx.QueryRow("SELECT email, name FROM users WHERE id = ?", userID).Scan(&email, &name); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if violations := validatePassword(req.NewPassword, email, name); len(violations) > 0 {
+		return passwordPolicyError(c, violations)
+	}
+
+	newHashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to hash new password"})
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", string(newHashed), userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// semua sesi lama harus login ulang (refresh + access token)
+	if err := revokeAllSessions(tx, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "password has been reset, please login again"})
+}
+
+// =======================================
+// HELPER: Reset Link & Email
+// =======================================
+func passwordResetLink(token string) string {
+	return fmt.Sprintf("%sreset-password?token=%s", frontendURL(), url.QueryEscape(token))
+}
+
+func passwordResetEmail(to, name, locale, link string) (Message, error) {
+	return renderEmail("password_reset", locale, to, map[string]any{
+		"Name": name,
+		"Link": link,
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Daftar password umum / bocor, dibundel supaya bisa dicek tanpa internet
+//
+//go:embed data/common-passwords.txt
+var commonPasswordsFile string
+
+var commonPasswords = map[string]bool{}
+
+// Aturan password (diatur lewat env PASSWORD_*)
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	MaxLength     int  `json:"max_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+}
+
+// satu aturan yang dilanggar, dirender per rule oleh front-end
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Value   int    `json:"value,omitempty"`
+}
+
+// bcrypt hanya memakai 72 byte pertama
+var passwordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 72, RequireLower: true, RequireDigit: true}
+
+func initPasswordPolicy() {
+	passwordPolicy.MinLength = envInt("PASSWORD_MIN_LENGTH", passwordPolicy.MinLength)
+	passwordPolicy.RequireUpper = envBool("PASSWORD_REQUIRE_UPPER", passwordPolicy.RequireUpper)
+	passwordPolicy.RequireLower = envBool("PASSWORD_REQUIRE_LOWER", passwordPolicy.RequireLower)
+	passwordPolicy.RequireDigit = envBool("PASSWORD_REQUIRE_DIGIT", passwordPolicy.RequireDigit)
+	passwordPolicy.RequireSymbol = envBool("PASSWORD_REQUIRE_SYMBOL", passwordPolicy.RequireSymbol)
+	if passwordPolicy.MinLength < 1 || passwordPolicy.MinLength > passwordPolicy.MaxLength {
+		log.Fatal("invalid PASSWORD_MIN_LENGTH: ", passwordPolicy.MinLength)
+	}
+
+	loadCommonPasswords(commonPasswordsFile)
+	// daftar tambahan (mis. top 100k dari korpus bocor) tanpa perlu build ulang
+	if path := getEnv("COMMON_PASSWORDS_FILE", ""); path != "" {
+		extra, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal("failed to read COMMON_PASSWORDS_FILE: ", err)
+		}
+		loadCommonPasswords(string(extra))
+	}
+}
+
+// satu password per baris, baris kosong & komentar (#) dilewati
+func loadCommonPasswords(list string) {
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			commonPasswords[strings.ToLower(line)] = true
+		}
+	}
+}
+
+// =======================================
+// VALIDASI password terhadap policy
+// =======================================
+// email & name dipakai untuk menolak password yang sama dengan identitas user
+func validatePassword(password, email, name string) []PasswordViolation {
+	p := passwordPolicy
+	var violations []PasswordViolation
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule: "min_length", Message: "password must be at least " + strconv.Itoa(p.MinLength) + " characters", Value: p.MinLength,
+		})
+	}
+	if len(password) > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Rule: "max_length", Message: "password must be at most " + strconv.Itoa(p.MaxLength) + " bytes", Value: p.MaxLength,
+		})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, PasswordViolation{Rule: "upper", Message: "password must contain an uppercase letter"})
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, PasswordViolation{Rule: "lower", Message: "password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, PasswordViolation{Rule: "digit", Message: "password must contain a digit"})
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, PasswordViolation{Rule: "symbol", Message: "password must contain a symbol"})
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if email != "" && (lowered == strings.ToLower(email) || lowered == localPart) {
+		violations = append(violations, PasswordViolation{Rule: "not_email", Message: "password must not be the same as your email"})
+	}
+	if strings.TrimSpace(name) != "" && lowered == strings.ToLower(strings.TrimSpace(name)) {
+		violations = append(violations, PasswordViolation{Rule: "not_name", Message: "password must not be the same as your name"})
+	}
+	if commonPasswords[lowered] {
+		violations = append(violations, PasswordViolation{Rule: "common", Message: "password is too common or has appeared in a data breach"})
+	}
+	return violations
+}
+
+// response 400 standar untuk password yang tidak lolos policy
+func passwordPolicyError(c *fiber.Ctx, violations []PasswordViolation) error {
+	return c.Status(400).JSON(fiber.Map{
+		"error":      "password does not meet policy",
+		"violations": violations,
+	})
+}
+
+// =======================================
+// GET policy (supaya front-end bisa tampilkan aturan)
+// =======================================
+func getPasswordPolicy(c *fiber.Ctx) error {
+	return c.JSON(passwordPolicy)
+}
+
+func envInt(key string, fallback int) int {
+	v, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func envBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withPasswordPolicy(t *testing.T, p PasswordPolicy) {
+	t.Helper()
+	prev, prevCommon := passwordPolicy, commonPasswords
+	t.Cleanup(func() { passwordPolicy, commonPasswords = prev, prevCommon })
+	commonPasswords = map[string]bool{}
+	initPasswordPolicy()
+	passwordPolicy = p
+}
+
+func violationRules(violations []PasswordViolation) []string {
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+// satu aturan dilanggar -> tepat satu kode rule
+func TestValidatePasswordRules(t *testing.T) {
+	withPasswordPolicy(t, PasswordPolicy{MinLength: 8, MaxLength: 72, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true})
+
+	tests := []struct {
+		name, password string
+		want           string
+	}{
+		{"min length", "Kb7!zq", "min_length"},
+		{"max length", "Kb7!" + strings.Repeat("z", 69), "max_length"},
+		{"upper", "kb7!zqxw", "upper"},
+		{"lower", "KB7!ZQXW", "lower"},
+		{"digit", "Kbr!zqxw", "digit"},
+		{"symbol", "Kb7tzqxw", "symbol"},
+		{"same as email", "Wulan.8!@Example.com", "not_email"},
+		{"same as email local part", "Wulan.8!", "not_email"},
+		{"same as name", "Sari Dewi 8!", "not_name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationRules(validatePassword(tt.password, "wulan.8!@example.com", "sari dewi 8!"))
+			if len(got) != 1 || got[0] != tt.want {
+				t.Fatalf("validatePassword(%q) rules = %v, want [%s]", tt.password, got, tt.want)
+			}
+		})
+	}
+
+	if got := validatePassword("Kb7!zqxw", "wulan@example.com", "Sari"); len(got) != 0 {
+		t.Errorf("valid password rejected: %+v", got)
+	}
+}
+
+// password yang lolos semua aturan lain tapi ada di daftar bocor ditolak dengan rule "common"
+func TestValidatePasswordCommon(t *testing.T) {
+	withPasswordPolicy(t, PasswordPolicy{MinLength: 8, MaxLength: 72, RequireLower: true, RequireDigit: true})
+
+	if len(commonPasswords) < 7000 {
+		t.Fatalf("embedded list has %d entries", len(commonPasswords))
+	}
+	for _, password := range []string{"trustno1", "Password123", "1qaz2wsx", "abcd1234"} {
+		got := violationRules(validatePassword(password, "wulan@example.com", "Wulan"))
+		if len(got) != 1 || got[0] != "common" {
+			t.Errorf("validatePassword(%q) rules = %v, want [common]", password, got)
+		}
+	}
+}
+
+func TestCommonPasswordsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("# tambahan\nTokoBudi2025\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COMMON_PASSWORDS_FILE", path)
+	withPasswordPolicy(t, passwordPolicy)
+
+	got := violationRules(validatePassword("tokobudi2025", "", ""))
+	if len(got) != 1 || got[0] != "common" {
+		t.Fatalf("rules = %v, want [common]", got)
+	}
+}
+
+// register: respons 400 berisi daftar rule untuk front-end
+func TestRegisterRejectsCommonPassword(t *testing.T) {
+	withPasswordPolicy(t, passwordPolicy)
+	newMockDB(t)
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/register", registerProcess)
+
+	resp, body := doRequest(t, app, "POST", "/api/register", `{"name":"Wulan","email":"wulan@example.com","password":"password123"}`)
+	if resp.StatusCode != 400 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Violations []PasswordViolation `json:"violations"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := violationRules(out.Violations); len(got) != 1 || got[0] != "common" {
+		t.Fatalf("violations = %s", body)
+	}
+}
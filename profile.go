@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// masa berlaku link konfirmasi email baru
+const changeEmailTokenTTL = 24 * time.Hour
+
+// =======================================
+// GET profil user login
+// =======================================
+func getMe(c *fiber.Ctx) error {
+	user, err := getUserByID(currentUserID(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(user)
+}
+
+// =======================================
+// UPDATE profil (field yang tidak dikirim tidak diubah)
+// =======================================
+// Email tidak bisa diganti di sini, lihat changeEmailProcess.
+func updateMe(c *fiber.Ctx) error {
+	req := new(struct {
+		Name         *string `json:"name"`
+		Organization *string `json:"organization"`
+		Whatsapp     *string `json:"whatsapp"`
+		Locale       *string `json:"locale"`
+	})
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "name cannot be empty"})
+	}
+
+	userID := currentUserID(c)
+	user, err := getUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if req.Name != nil {
+		user.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Organization != nil {
+		user.Organization = *req.Organization
+	}
+	if req.Whatsapp != nil {
+		user.Whatsapp = *req.Whatsapp
+	}
+	if req.Locale != nil {
+		user.Locale = normalizeLocale(*req.Locale)
+	}
+
+	_, err = db.Exec(
+		"UPDATE users SET name = ?, organization = ?, whatsapp = ?, locale = ? WHERE id = ?",
+		user.Name, user.Organization, user.Whatsapp, user.Locale, userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(user)
+}
+
+// =======================================
+// CHANGE EMAIL: kirim konfirmasi ke email baru
+// =======================================
+// Email baru baru berlaku setelah link di email konfirmasi diklik.
+func changeEmailProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		NewEmail string `json:"newEmail"`
+		Password string `json:"password"`
+	})
+	if err := c.BodyParser(req); err != nil || !strings.Contains(req.NewEmail, "@") {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	req.NewEmail = strings.TrimSpace(req.NewEmail)
+
+	userID := currentUserID(c)
+	var name, email, locale, hashedPassword string
+	err := db.QueryRow("SELECT name, email, locale, password FROM users WHERE id = ?", userID).
+		Scan(&name, &email, &locale, &hashedPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "user not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "password is incorrect"})
+	}
+	if strings.EqualFold(req.NewEmail, email) {
+		return c.Status(400).JSON(fiber.Map{"error": "new email is the same as current email"})
+	}
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", req.NewEmail).Scan(&exists); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if exists > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "email already registered"})
+	}
+
+	throttled, err := userTokenThrottled(userID, purposeChangeEmail, time.Minute, 5)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if throttled {
+		c.Set(fiber.HeaderRetryAfter, "60")
+		return c.Status(429).JSON(fiber.Map{"error": "too many requests, please wait before requesting another email"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	token, err := createUserTokenWithData(tx, userID, purposeChangeEmail, req.NewEmail, changeEmailTokenTTL)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	msg, err := renderEmail("change_email", locale, req.NewEmail, map[string]any{
+		"Name":     name,
+		"NewEmail": req.NewEmail,
+		"Link":     changeEmailLink(token),
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "please check your new email to confirm the change"})
+}
+
+// =======================================
+// CONFIRM EMAIL BARU (link dari email)
+// =======================================
+func confirmEmailChangeHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(400).SendString("Invalid confirmation link")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+	defer tx.Rollback()
+
+	userID, newEmail, err := consumeUserTokenData(tx, purposeChangeEmail, token)
+	if err != nil {
+		if err == errUserTokenInvalid {
+			return c.Status(400).SendString("Invalid or expired confirmation link")
+		}
+		return c.Status(500).SendString("Failed to change email")
+	}
+
+	var name, oldEmail, locale string
+	err = tx.QueryRow("SELECT name, email, locale FROM users WHERE id = ? FOR UPDATE", userID).
+		Scan(&name, &oldEmail, &locale)
+	if err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+
+	// email bisa saja sudah dipakai akun lain sejak link dikirim
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", newEmail).Scan(&exists); err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+	if exists > 0 {
+		return c.Status(400).SendString("Email already registered")
+	}
+
+	// link dibuka dari inbox email baru, jadi sekaligus terverifikasi
+	_, err = tx.Exec(
+		"UPDATE users SET email = ?, email_verified_at = ? WHERE id = ?",
+		newEmail, time.Now(), userID,
+	)
+	if err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+
+	// pemberitahuan ke email lama
+	msg, err := renderEmail("email_changed", locale, oldEmail, map[string]any{
+		"Name":     name,
+		"NewEmail": newEmail,
+	})
+	if err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).SendString("Failed to change email")
+	}
+
+	return c.Redirect(frontendURL()+"?email=changed", fiber.StatusSeeOther)
+}
+
+func changeEmailLink(token string) string {
+	apiURL := os.Getenv("VPS_APP_URL")
+	return fmt.Sprintf("%sapi/me/email/confirm?token=%s", apiURL, token)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var userColumns = []string{"id", "role_id", "name", "email", "organization", "whatsapp", "locale"}
+
+func expectUserByID(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(q("FROM users")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(tenantUserA, roleMember, "Budi", "budi@example.com", "Toko Budi", "0812", "id"))
+	mock.ExpectQuery(q("FROM user_product_entitlements")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+}
+
+// field yang tidak dikirim tetap memakai nilai lama
+func TestUpdateMePartial(t *testing.T) {
+	mock := newMockDB(t)
+	expectUserByID(mock)
+	mock.ExpectExec(q("UPDATE users SET name = ?, organization = ?, whatsapp = ?, locale = ? WHERE id = ?")).
+		WithArgs("Budi Santoso", "Toko Budi", "0812", "en", tenantUserA).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := newTestApp(tenantUserA, 0, "")
+	app.Put("/api/me", updateMe)
+
+	resp, body := doRequest(t, app, "PUT", "/api/me", `{"name":"  Budi Santoso ","locale":"en"}`)
+	if resp.StatusCode != 200 || !strings.Contains(body, `"name":"Budi Santoso"`) || !strings.Contains(body, `"email":"budi@example.com"`) {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+}
+
+func TestUpdateMeRejectsEmptyName(t *testing.T) {
+	newMockDB(t)
+	app := newTestApp(tenantUserA, 0, "")
+	app.Put("/api/me", updateMe)
+
+	if resp, body := doRequest(t, app, "PUT", "/api/me", `{"name":"   "}`); resp.StatusCode != 400 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+}
+
+func TestChangeEmailRejected(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("rahasia-kuat-123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCurrent := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(q("SELECT name, email, locale, password FROM users WHERE id = ?")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "email", "locale", "password"}).
+				AddRow("Budi", "budi@example.com", "id", string(hashed)))
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{"invalid email", `{"newEmail":"bukan-email","password":"rahasia-kuat-123"}`, func(sqlmock.Sqlmock) {}},
+		{"wrong password", `{"newEmail":"baru@example.com","password":"salah"}`, expectCurrent},
+		{"same email", `{"newEmail":"BUDI@example.com","password":"rahasia-kuat-123"}`, expectCurrent},
+		{"email taken", `{"newEmail":"ani@example.com","password":"rahasia-kuat-123"}`, func(mock sqlmock.Sqlmock) {
+			expectCurrent(mock)
+			mock.ExpectQuery(q("SELECT COUNT(*) FROM users WHERE email = ?")).
+				WithArgs("ani@example.com").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDB(t)
+			tt.expect(mock)
+
+			app := newTestApp(tenantUserA, 0, "")
+			app.Post("/api/me/email", changeEmailProcess)
+			if resp, body := doRequest(t, app, "POST", "/api/me/email", tt.body); resp.StatusCode != 400 {
+				t.Fatalf("status %d body %s, want 400", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+// Minta ganti email -> link dikirim ke email baru -> buka link -> email berubah + pemberitahuan ke email lama
+func TestChangeEmailConfirmation(t *testing.T) {
+	t.Setenv("VPS_APP_URL", "https://api.example.test/")
+	t.Setenv("FRONTEND_URL", "https://dash.example.test/")
+	mock := newMockDB(t)
+
+	const newEmail = "budi.baru@example.com"
+	hashed, err := bcrypt.GenerateFromPassword([]byte("rahasia-kuat-123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		tokenHash   = &captureArg{}
+		confirmText = &captureArg{}
+		confirmLink = regexp.MustCompile(`https://api\.example\.test(/api/me/email/confirm\?token=\w+)`)
+	)
+
+	// ===== minta ganti email =====
+	mock.ExpectQuery(q("SELECT name, email, locale, password FROM users WHERE id = ?")).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "email", "locale", "password"}).
+			AddRow("Budi", "budi@example.com", "id", string(hashed)))
+	mock.ExpectQuery(q("SELECT COUNT(*) FROM users WHERE email = ?")).
+		WithArgs(newEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(q("FROM user_tokens")).
+		WithArgs(sqlmock.AnyArg(), tenantUserA, purposeChangeEmail, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "too_soon"}).AddRow(0, false))
+	mock.ExpectBegin()
+	mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(q("INSERT INTO user_tokens")).
+		WithArgs(tenantUserA, purposeChangeEmail, tokenHash, newEmail, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(q("INSERT INTO email_outbox")).
+		WithArgs(newEmail, sqlmock.AnyArg(), confirmText, sqlmock.AnyArg(), outboxPending, outboxMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	app := newTestApp(tenantUserA, 0, "")
+	app.Post("/api/me/email", changeEmailProcess)
+	app.Get("/api/me/email/confirm", confirmEmailChangeHandler)
+
+	resp, body := doRequest(t, app, "POST", "/api/me/email", `{"newEmail":"`+newEmail+`","password":"rahasia-kuat-123"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("request: status %d body %s", resp.StatusCode, body)
+	}
+	m := confirmLink.FindStringSubmatch(confirmText.value)
+	if m == nil {
+		t.Fatalf("no confirmation link in email:\n%s", confirmText.value)
+	}
+
+	// ===== buka link dari inbox email baru =====
+	mock.ExpectBegin()
+	mock.ExpectQuery(q("FROM user_tokens")).
+		WithArgs(sqlmock.AnyArg(), tokenHash.value, purposeChangeEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "data", "used_at", "expired"}).
+			AddRow(1, tenantUserA, newEmail, nil, false))
+	mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(q("SELECT name, email, locale FROM users WHERE id = ? FOR UPDATE")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "email", "locale"}).AddRow("Budi", "budi@example.com", "id"))
+	mock.ExpectQuery(q("SELECT COUNT(*) FROM users WHERE email = ?")).
+		WithArgs(newEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(q("UPDATE users SET email = ?, email_verified_at = ? WHERE id = ?")).
+		WithArgs(newEmail, sqlmock.AnyArg(), tenantUserA).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("INSERT INTO email_outbox")).
+		WithArgs("budi@example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), outboxPending, outboxMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	resp, body = doRequest(t, app, "GET", m[1], "")
+	if resp.StatusCode != 303 || resp.Header.Get(fiber.HeaderLocation) != "https://dash.example.test/?email=changed" {
+		t.Fatalf("confirm: status %d location %q body %s", resp.StatusCode, resp.Header.Get(fiber.HeaderLocation), body)
+	}
+}
+
+// email baru sudah dipakai akun lain sejak link dikirim: tidak diganti
+func TestChangeEmailConfirmEmailTaken(t *testing.T) {
+	mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(q("FROM user_tokens")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "data", "used_at", "expired"}).
+			AddRow(1, tenantUserA, "ani@example.com", nil, false))
+	mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(q("SELECT name, email, locale FROM users WHERE id = ? FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "email", "locale"}).AddRow("Budi", "budi@example.com", "id"))
+	mock.ExpectQuery(q("SELECT COUNT(*) FROM users WHERE email = ?")).
+		WithArgs("ani@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	app := newTestApp(0, 0, "")
+	app.Get("/api/me/email/confirm", confirmEmailChangeHandler)
+
+	if resp, body := doRequest(t, app, "GET", "/api/me/email/confirm?token=abc", ""); resp.StatusCode != 400 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+}
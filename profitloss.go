@@ -2,6 +2,11 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"strconv"
@@ -15,31 +20,158 @@ func atoi(s string) int {
 	return val
 }
 
+// helper exec untuk query yang sudah di-scope ke pemilik (... AND organization_id = ?),
+// sql.ErrNoRows kalau tidak ada baris milik organisasi yang kena
+func execOwned(query string, args ...any) error {
+	return execOwnedTx(db, query, args...)
+}
+
+// sama seperti execOwned, tapi bisa dipakai di dalam transaksi
+func execOwnedTx(ex execer, query string, args ...any) error {
+	res, err := ex.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // =======================================
 // CRUD ProfitLoss
 // =======================================
 
-// GET all
+// batas baris per halaman /list
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// kolom yang boleh dipakai untuk sort / filter nominal
+var profitLossSortFields = map[string]bool{"date": true, "revenue": true, "expense": true, "profitloss": true}
+
+// posisi terakhir halaman sebelumnya (di-encode base64 di response).
+// Sort, arah dan filter ikut disimpan: cursor hanya berlaku untuk query yang sama.
+type listCursor struct {
+	Value     string `json:"v"`
+	ID        int    `json:"id"`
+	Sort      string `json:"s"`
+	Direction string `json:"d"`
+	Filter    string `json:"f"`
+}
+
+// GET all (cursor pagination + filter + sort)
+//
+// Response: {"data": [...], "total": n, "limit": n, "next_cursor": "..."}.
+// Sebelumnya endpoint ini mengembalikan array polos; klien lama harus membaca field "data".
 func getAllProfitLoss(c *fiber.Ctx) error {
-	req := new(struct {
-		UserID int `json:"userID"`
-	})
-	if err := c.BodyParser(req); err != nil {
+	orgID := currentOrgID(c)
+
+	req := new(ProfitLossListRequest)
+	var err error
+	if len(c.Body()) > 0 {
+		err = c.BodyParser(req)
+	} else {
+		err = c.QueryParser(req)
+	}
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
 
-	rows, err := db.Query(`
-        SELECT id, date, revenue, expense, profitloss 
-        FROM profit_losses 
-        WHERE user_id = ? 
-        ORDER BY date DESC
-    `, req.UserID)
+	if req.Limit <= 0 {
+		req.Limit = defaultListLimit
+	}
+	if req.Limit > maxListLimit {
+		req.Limit = maxListLimit
+	}
+	if req.Sort == "" {
+		req.Sort = "date"
+	}
+	if req.AmountField == "" {
+		req.AmountField = "profitloss"
+	}
+	req.Direction = strings.ToLower(req.Direction)
+	if req.Direction == "" {
+		req.Direction = "desc"
+	}
+	if !profitLossSortFields[req.Sort] || req.Direction != "asc" && req.Direction != "desc" ||
+		!profitLossSortFields[req.AmountField] || req.AmountField == "date" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid sort, direction or amount_field"})
+	}
+
+	// filter (tanpa cursor) dipakai juga untuk total
+	where := "organization_id = ?"
+	args := []any{orgID}
+	if req.From != "" {
+		if _, err := time.Parse("2006-01-02", req.From); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid from date"})
+		}
+		where += " AND date >= ?"
+		args = append(args, req.From)
+	}
+	if req.To != "" {
+		if _, err := time.Parse("2006-01-02", req.To); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid to date"})
+		}
+		where += " AND date <= ?"
+		args = append(args, req.To)
+	}
+	if req.MinAmount != nil {
+		where += " AND " + req.AmountField + " >= ?"
+		args = append(args, *req.MinAmount)
+	}
+	if req.MaxAmount != nil {
+		where += " AND " + req.AmountField + " <= ?"
+		args = append(args, *req.MaxAmount)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM profit_losses WHERE "+where, args...).Scan(&total); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// keyset: (kolom sort, id) setelah posisi cursor
+	op := "<"
+	if req.Direction == "asc" {
+		op = ">"
+	}
+	filter := listFilterKey(req)
+	pageWhere, pageArgs := where, args
+	if req.Cursor != "" {
+		cur, err := decodeListCursor(req.Cursor)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+		if cur.Sort != req.Sort || cur.Direction != req.Direction || cur.Filter != filter {
+			return c.Status(400).JSON(fiber.Map{
+				"error":  "cursor does not match request",
+				"detail": "sort, direction dan filter harus sama dengan request yang menghasilkan cursor",
+			})
+		}
+		pageWhere += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", req.Sort, op)
+		pageArgs = append(append([]any{}, args...), cur.Value, cur.Value, cur.ID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, date, revenue, expense, profitloss
+		FROM profit_losses
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT ?
+	`, pageWhere, req.Sort, req.Direction, req.Direction)
+	// ambil satu baris lebih untuk tahu masih ada halaman berikutnya
+	rows, err := db.Query(query, append(pageArgs, req.Limit+1)...)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	defer rows.Close()
 
-	var result []ProfitLoss
+	result := []ProfitLoss{}
 	for rows.Next() {
 		var pl ProfitLoss
 		if err := rows.Scan(&pl.ID, &pl.Date, &pl.Revenue, &pl.Expense, &pl.ProfitLoss); err != nil {
@@ -47,25 +179,86 @@ func getAllProfitLoss(c *fiber.Ctx) error {
 		}
 		result = append(result, pl)
 	}
-	return c.JSON(result)
+
+	var nextCursor string
+	if len(result) > req.Limit {
+		result = result[:req.Limit]
+		last := result[len(result)-1]
+		nextCursor = encodeListCursor(listCursor{
+			Value:     sortValue(last, req.Sort),
+			ID:        last.ID,
+			Sort:      req.Sort,
+			Direction: req.Direction,
+			Filter:    filter,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        result,
+		"total":       total,
+		"limit":       req.Limit,
+		"next_cursor": nextCursor, // kosong = halaman terakhir
+	})
+}
+
+// sidik jari filter /list (disimpan di cursor)
+func listFilterKey(req *ProfitLossListRequest) string {
+	amount := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	key := strings.Join([]string{req.From, req.To, req.AmountField, amount(req.MinAmount), amount(req.MaxAmount)}, "|")
+	return hashToken(key)[:16]
+}
+
+func sortValue(pl ProfitLoss, field string) string {
+	switch field {
+	case "revenue":
+		return strconv.FormatFloat(pl.Revenue, 'f', -1, 64)
+	case "expense":
+		return strconv.FormatFloat(pl.Expense, 'f', -1, 64)
+	case "profitloss":
+		return strconv.FormatFloat(pl.ProfitLoss, 'f', -1, 64)
+	}
+	return pl.Date
+}
+
+func encodeListCursor(cur listCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	var cur listCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, err
+	}
+	err = json.Unmarshal(b, &cur)
+	return cur, err
 }
 
 // GET by ID
 func getProfitLossByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var pl ProfitLoss
-	err := db.QueryRow("SELECT id, date, revenue, expense, profitloss FROM profit_losses WHERE id = ?", id).
-		Scan(&pl.ID, &pl.Date, &pl.Revenue, &pl.Expense, &pl.ProfitLoss)
+	err := db.QueryRow("SELECT id, user_id, organization_id, date, revenue, expense, profitloss FROM profit_losses WHERE id = ? AND organization_id = ?", id, currentOrgID(c)).
+		Scan(&pl.ID, &pl.UserID, &pl.OrganizationID, &pl.Date, &pl.Revenue, &pl.Expense, &pl.ProfitLoss)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{"error": "not found"})
 		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	if pl.Items, err = getProfitLossItems(pl.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 	return c.JSON(pl)
 }
 
-// CREATE with app_key validation
+// CREATE
 func createProfitLoss(c *fiber.Ctx) error {
 	pl := new(ProfitLoss)
 
@@ -77,47 +270,44 @@ func createProfitLoss(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validasi user_id & app_key
-	if pl.UserID == 0 || pl.AppKey == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error":  "user_id and app_key are required",
-			"detail": "Pastikan field 'user_id' dan 'app_key' ada dan tidak kosong",
-		})
-	}
-
-	// Cek apakah user_id & app_key valid
-	var valid int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ? AND app_key = ?", pl.UserID, pl.AppKey).Scan(&valid)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-	}
-	if valid == 0 {
-		return c.Status(403).JSON(fiber.Map{
-			"error":  "invalid credentials",
-			"detail": "user_id dan app_key tidak valid",
-		})
-	}
+	// user_id & organisasi selalu dari token/header, bukan dari body
+	pl.UserID = currentUserID(c)
+	pl.OrganizationID = currentOrgID(c)
 
-	// Validasi tanggal unik per user
+	// Validasi tanggal unik per organisasi
 	var exists int
-	err = db.QueryRow("SELECT COUNT(*) FROM profit_losses WHERE date = ? AND user_id = ?", pl.Date, pl.UserID).Scan(&exists)
+	err := db.QueryRow("SELECT COUNT(*) FROM profit_losses WHERE date = ? AND organization_id = ?", pl.Date, pl.OrganizationID).Scan(&exists)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	if exists > 0 {
 		return c.Status(400).JSON(fiber.Map{
 			"error":  "date already exists",
-			"detail": "Sudah ada record dengan tanggal yang sama untuk user ini",
+			"detail": "Sudah ada record dengan tanggal yang sama untuk organisasi ini",
 		})
 	}
 
+	// Kalau ada line item, revenue/expense dihitung dari item
+	if len(pl.Items) > 0 {
+		pl.Revenue, pl.Expense, err = rollupItems(pl.OrganizationID, pl.Items)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid items", "detail": err.Error()})
+		}
+	}
+
 	// Hitung profit/loss
 	pl.ProfitLoss = pl.Revenue - pl.Expense
 
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
 	// Insert ke database
-	res, err := db.Exec(
-		"INSERT INTO profit_losses (user_id, date, revenue, expense, profitloss) VALUES (?, ?, ?, ?, ?)",
-		pl.UserID, pl.Date, pl.Revenue, pl.Expense, pl.ProfitLoss,
+	res, err := tx.Exec(
+		"INSERT INTO profit_losses (user_id, organization_id, date, revenue, expense, profitloss) VALUES (?, ?, ?, ?, ?, ?)",
+		pl.UserID, pl.OrganizationID, pl.Date, pl.Revenue, pl.Expense, pl.ProfitLoss,
 	)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -126,33 +316,106 @@ func createProfitLoss(c *fiber.Ctx) error {
 	id, _ := res.LastInsertId()
 	pl.ID = int(id)
 
+	if err := replaceProfitLossItems(tx, pl.ID, pl.Items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateStats(pl.OrganizationID)
+
 	return c.JSON(pl)
 }
 
 // UPDATE
+// "items" diisi = item diganti semua (list kosong = kembali ke total manual);
+// tanpa "items", baris yang punya item tidak boleh diubah totalnya langsung.
 func updateProfitLoss(c *fiber.Ctx) error {
 	id := c.Params("id")
 	pl := new(ProfitLoss)
 	if err := c.BodyParser(pl); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
+	pl.ID = atoi(id)
+	pl.OrganizationID = currentOrgID(c)
+
+	var err error
+	if pl.Items != nil {
+		if len(pl.Items) > 0 {
+			pl.Revenue, pl.Expense, err = rollupItems(pl.OrganizationID, pl.Items)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "invalid items", "detail": err.Error()})
+			}
+		}
+	} else {
+		// dibatasi organisasi aktif: baris organisasi lain dihitung 0 lalu jadi 404 di UPDATE
+		var itemCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM profit_loss_items i
+			JOIN profit_losses pl ON pl.id = i.profit_loss_id
+			WHERE i.profit_loss_id = ? AND pl.organization_id = ?
+		`, pl.ID, pl.OrganizationID).Scan(&itemCount)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if itemCount > 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error":  "entry has line items",
+				"detail": "Kirim field 'items' (list kosong untuk kembali ke total manual)",
+			})
+		}
+	}
 	pl.ProfitLoss = pl.Revenue - pl.Expense
-	_, err := db.Exec("UPDATE profit_losses SET date=?, revenue=?, expense=?, profitloss=? WHERE id=?",
-		pl.Date, pl.Revenue, pl.Expense, pl.ProfitLoss, id)
+
+	tx, err := db.Begin()
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	pl.ID = atoi(id)
+	defer tx.Rollback()
+
+	err = execOwnedTx(tx, "UPDATE profit_losses SET date=?, revenue=?, expense=?, profitloss=? WHERE id=? AND organization_id=?",
+		pl.Date, pl.Revenue, pl.Expense, pl.ProfitLoss, id, pl.OrganizationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if pl.Items != nil {
+		if err := replaceProfitLossItems(tx, pl.ID, pl.Items); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateStats(pl.OrganizationID)
 	return c.JSON(pl)
 }
 
 // DELETE
 func deleteProfitLoss(c *fiber.Ctx) error {
 	id := c.Params("id")
-	_, err := db.Exec("DELETE FROM profit_losses WHERE id=?", id)
+	tx, err := db.Begin()
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	defer tx.Rollback()
+
+	err = execOwnedTx(tx, "DELETE FROM profit_losses WHERE id=? AND organization_id=?", id, currentOrgID(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := tx.Exec("DELETE FROM profit_loss_items WHERE profit_loss_id = ?", id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateStats(currentOrgID(c))
 	return c.JSON(fiber.Map{"message": "deleted"})
 }
 
@@ -355,136 +618,134 @@ func deleteProfitLoss(c *fiber.Ctx) error {
 //		})
 //	}
 func getProfitLossStats(c *fiber.Ctx) error {
+	orgID := currentOrgID(c)
+
 	req := new(StatsRequest)
-	if err := c.BodyParser(req); err != nil {
+	var err error
+	if len(c.Body()) > 0 {
+		err = c.BodyParser(req)
+	} else {
+		err = c.QueryParser(req)
+	}
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
-
-	rows, err := db.Query(`
-        SELECT id, date, revenue, expense, profitloss 
-        FROM profit_losses 
-        WHERE user_id = ? 
-        ORDER BY date ASC
-    `, req.UserID)
+	rng, err := parseStatsRange(*req, time.Now())
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer rows.Close()
 
-	var result []ProfitLoss
-	dailyRevenue := make(map[string]float64)
-	dailyExpense := make(map[string]float64)
-	dailyProfitloss := make(map[string]float64)
-
-	monthlyRevenue := make(map[string]float64)
-	monthlyExpense := make(map[string]float64)
-	monthlyProfitloss := make(map[string]float64)
-
-	yearlyRevenue := make(map[string]float64)
-	yearlyExpense := make(map[string]float64)
-	yearlyProfitloss := make(map[string]float64)
-
-	// insight tambahan
-	var totalRevenue, totalExpense, totalProfit float64
-	var maxRevenue, maxExpense, maxProfit float64
-	var minRevenue, minExpense, minProfit float64
-	minRevenue, minExpense, minProfit = 999999, 999999, 999999
-
-	// tanggal hari ini
+	// key ikut tanggal hari ini karena daily/monthly relatif ke hari ini
 	now := time.Now()
-	currentYear, currentMonth, _ := now.Date()
-	loc := now.Location()
-
-	// range daily (bulan ini)
-	firstDay := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, loc)
-	lastDay := firstDay.AddDate(0, 1, -1)
-
-	for rows.Next() {
-		var pl ProfitLoss
-		var dateStr string
-		if err := rows.Scan(&pl.ID, &dateStr, &pl.Revenue, &pl.Expense, &pl.ProfitLoss); err != nil {
+	key := statsCacheKey(rng, now)
+	entry, ok, err := statsSummaries.Get(orgID, key)
+	if err != nil {
+		log.Println("stats cache:", err)
+	}
+	if !ok {
+		entry.ComputedAt = now
+		stats, err := buildProfitLossStats(orgID, rng, now)
+		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
-
-		// parsing tanggal
-		t, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "invalid date format"})
+		if entry.Body, err = json.Marshal(stats); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
-
-		pl.Date = dateStr
-		result = append(result, pl)
-
-		// daily (hanya bulan ini)
-		if !t.Before(firstDay) && !t.After(lastDay) {
-			dayKey := t.Format("2006-01-02")
-			dailyRevenue[dayKey] += pl.Revenue
-			dailyExpense[dayKey] += pl.Expense
-			dailyProfitloss[dayKey] += pl.ProfitLoss
+		entry.ETag = statsETag(entry.Body)
+		if err := statsSummaries.Set(orgID, key, entry); err != nil {
+			log.Println("stats cache:", err)
 		}
+	}
 
-		// monthly (hanya tahun ini)
-		if t.Year() == currentYear {
-			monthKey := t.Format("January 2006")
-			monthlyRevenue[monthKey] += pl.Revenue
-			monthlyExpense[monthKey] += pl.Expense
-			monthlyProfitloss[monthKey] += pl.ProfitLoss
-		}
+	c.Set(fiber.HeaderETag, entry.ETag)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), entry.ETag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(entry.Body)
+}
 
-		// yearly (semua tahun)
-		yearKey := t.Format("2006")
-		yearlyRevenue[yearKey] += pl.Revenue
-		yearlyExpense[yearKey] += pl.Expense
-		yearlyProfitloss[yearKey] += pl.ProfitLoss
+// hitung seluruh isi response stats (dipanggil kalau cache miss)
+func buildProfitLossStats(orgID int, r statsRange, now time.Time) (fiber.Map, error) {
+	// semua agregasi dihitung MySQL (GROUP BY), tidak lagi scan seluruh histori di Go
+	firstDay := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	firstOfYear := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
 
-		// total
-		totalRevenue += pl.Revenue
-		totalExpense += pl.Expense
-		totalProfit += pl.ProfitLoss
+	// daily (bulan ini)
+	daily, err := sumBuckets(orgID, statsRange{from: firstDay, to: firstDay.AddDate(0, 1, -1), granularity: granularityDay})
+	if err != nil {
+		return nil, err
+	}
+	// monthly (Januari–Desember tahun ini)
+	monthly, err := sumBuckets(orgID, statsRange{from: firstOfYear, to: firstOfYear.AddDate(1, 0, -1), granularity: granularityMonth})
+	if err != nil {
+		return nil, err
+	}
+	// yearly (semua tahun)
+	yearly, err := sumYears(orgID)
+	if err != nil {
+		return nil, err
+	}
+	// series sesuai range & granularity request
+	series, err := sumBuckets(orgID, r)
+	if err != nil {
+		return nil, err
+	}
+	extremes, err := rowExtremes(orgID)
+	if err != nil {
+		return nil, err
+	}
 
-		// max & min
-		if pl.Revenue > maxRevenue {
-			maxRevenue = pl.Revenue
-		}
-		if pl.Revenue < minRevenue {
-			minRevenue = pl.Revenue
-		}
-		if pl.Expense > maxExpense {
-			maxExpense = pl.Expense
-		}
-		if pl.Expense < minExpense {
-			minExpense = pl.Expense
-		}
-		if pl.ProfitLoss > maxProfit {
-			maxProfit = pl.ProfitLoss
-		}
-		if pl.ProfitLoss < minProfit {
-			minProfit = pl.ProfitLoss
-		}
+	// data mentah hanya dalam range request
+	rows, err := db.Query(`
+		SELECT id, date, revenue, expense, profitloss
+		FROM profit_losses
+		WHERE organization_id = ? AND date BETWEEN ? AND ?
+		ORDER BY date ASC
+	`, orgID, r.from.Format("2006-01-02"), r.to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// isi daily kosong (bulan ini)
-	for d := firstDay; !d.After(lastDay); d = d.AddDate(0, 0, 1) {
-		dayKey := d.Format("2006-01-02")
-		if _, ok := dailyRevenue[dayKey]; !ok {
-			dailyRevenue[dayKey] = 0
-			dailyExpense[dayKey] = 0
-			dailyProfitloss[dayKey] = 0
+	var result []ProfitLoss
+	for rows.Next() {
+		var pl ProfitLoss
+		if err := rows.Scan(&pl.ID, &pl.Date, &pl.Revenue, &pl.Expense, &pl.ProfitLoss); err != nil {
+			return nil, err
 		}
+		result = append(result, pl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	// isi monthly kosong (Januari–Desember tahun ini)
-	for m := 1; m <= 12; m++ {
-		d := time.Date(currentYear, time.Month(m), 1, 0, 0, 0, 0, loc)
-		monthKey := d.Format("January 2006")
-		if _, ok := monthlyRevenue[monthKey]; !ok {
-			monthlyRevenue[monthKey] = 0
-			monthlyExpense[monthKey] = 0
-			monthlyProfitloss[monthKey] = 0
+	dailyRevenue := make(map[string]float64, len(daily))
+	dailyExpense := make(map[string]float64, len(daily))
+	dailyProfitloss := make(map[string]float64, len(daily))
+	// insight tambahan: rata-rata harian (bulan ini saja, hanya hari dengan transaksi)
+	var sumRevenue, sumExpense, sumProfit float64
+	countActiveDays := 0
+	for _, d := range daily {
+		dailyRevenue[d.Period] = d.Revenue
+		dailyExpense[d.Period] = d.Expense
+		dailyProfitloss[d.Period] = d.ProfitLoss
+		if d.Revenue != 0 || d.Expense != 0 || d.ProfitLoss != 0 {
+			sumRevenue += d.Revenue
+			sumExpense += d.Expense
+			sumProfit += d.ProfitLoss
+			countActiveDays++
 		}
 	}
+	avgRevenue, avgExpense, avgProfit := 0.0, 0.0, 0.0
+	if countActiveDays > 0 {
+		avgRevenue = sumRevenue / float64(countActiveDays)
+		avgExpense = sumExpense / float64(countActiveDays)
+		avgProfit = sumProfit / float64(countActiveDays)
+	}
 
-	// konversi monthly ke slice agar urut + margin
+	// bentuk monthlyStats lama
 	type MonthlyStat struct {
 		Month        string  `json:"month"`
 		Revenue      float64 `json:"revenue"`
@@ -492,70 +753,41 @@ func getProfitLossStats(c *fiber.Ctx) error {
 		ProfitLoss   float64 `json:"profitloss"`
 		ProfitMargin float64 `json:"profitMargin"`
 	}
-	var monthlyStats []MonthlyStat
-	for m := 1; m <= 12; m++ {
-		d := time.Date(currentYear, time.Month(m), 1, 0, 0, 0, 0, loc)
-		monthKey := d.Format("January 2006")
-		margin := 0.0
-		if monthlyRevenue[monthKey] > 0 {
-			margin = (monthlyProfitloss[monthKey] / monthlyRevenue[monthKey]) * 100
-		}
+	monthlyStats := make([]MonthlyStat, 0, len(monthly))
+	for _, m := range monthly {
 		monthlyStats = append(monthlyStats, MonthlyStat{
-			Month:        monthKey,
-			Revenue:      monthlyRevenue[monthKey],
-			Expense:      monthlyExpense[monthKey],
-			ProfitLoss:   monthlyProfitloss[monthKey],
-			ProfitMargin: margin,
+			Month:        m.Period,
+			Revenue:      m.Revenue,
+			Expense:      m.Expense,
+			ProfitLoss:   m.ProfitLoss,
+			ProfitMargin: m.ProfitMargin,
 		})
 	}
 
-	// yearly profit margin
-	yearlyProfitMargin := make(map[string]float64)
-	for year, rev := range yearlyRevenue {
-		if rev > 0 {
-			yearlyProfitMargin[year] = (yearlyProfitloss[year] / rev) * 100
-		} else {
-			yearlyProfitMargin[year] = 0
-		}
-	}
-
-	// insight tambahan: rata-rata harian (bulan ini saja, hanya hari dengan transaksi)
-	sumRevenue := 0.0
-	sumExpense := 0.0
-	sumProfit := 0.0
-	countActiveDays := 0
-
-	for day, rev := range dailyRevenue {
-		exp := dailyExpense[day]
-		prof := dailyProfitloss[day]
-
-		// hanya hitung kalau ada transaksi
-		if rev != 0 || exp != 0 || prof != 0 {
-			sumRevenue += rev
-			sumExpense += exp
-			sumProfit += prof
-			countActiveDays++
-		}
+	yearlyRevenue := make(map[string]float64, len(yearly))
+	yearlyExpense := make(map[string]float64, len(yearly))
+	yearlyProfitloss := make(map[string]float64, len(yearly))
+	yearlyProfitMargin := make(map[string]float64, len(yearly))
+	for _, y := range yearly {
+		yearlyRevenue[y.Period] = y.Revenue
+		yearlyExpense[y.Period] = y.Expense
+		yearlyProfitloss[y.Period] = y.ProfitLoss
+		yearlyProfitMargin[y.Period] = y.ProfitMargin
 	}
 
-	avgRevenue := 0.0
-	avgExpense := 0.0
-	avgProfit := 0.0
-	if countActiveDays > 0 {
-		avgRevenue = sumRevenue / float64(countActiveDays)
-		avgExpense = sumExpense / float64(countActiveDays)
-		avgProfit = sumProfit / float64(countActiveDays)
+	// kalau tidak ada data, minExpense 0 seperti sebelumnya (min lain tetap 999999)
+	if extremes.Count == 0 {
+		extremes.MinExpense = 0
 	}
 
-	// kalau tidak ada data, set min jadi 999999
-	if len(result) == 0 {
-		minRevenue = 999999
-		minExpense = 0
-		minProfit = 999999
+	// breakdown per kategori (line item) dalam range request
+	categoryStats, err := categoryBreakdown(orgID, r.from, r.to, monthLabels(r))
+	if err != nil {
+		return nil, err
 	}
 
-	return c.JSON(fiber.Map{
-		"data":               result,
+	return fiber.Map{
+		"data":               result, // hanya dalam range request
 		"dailyRevenue":       dailyRevenue,
 		"dailyExpense":       dailyExpense,
 		"dailyProfitloss":    dailyProfitloss,
@@ -567,11 +799,18 @@ func getProfitLossStats(c *fiber.Ctx) error {
 		"avgRevenue":         avgRevenue, // pendapatan rata-rata harian (bulan ini)
 		"avgExpense":         avgExpense, // beban rata-rata harian (bulan ini)
 		"avgProfit":          avgProfit,  // laba rata-rata harian (bulan ini)
-		"maxRevenue":         maxRevenue,
-		"minRevenue":         minRevenue,
-		"maxExpense":         maxExpense,
-		"minExpense":         minExpense,
-		"maxProfit":          maxProfit,
-		"minProfit":          minProfit,
-	})
+		"maxRevenue":         extremes.MaxRevenue,
+		"minRevenue":         extremes.MinRevenue,
+		"maxExpense":         extremes.MaxExpense,
+		"minExpense":         extremes.MinExpense,
+		"maxProfit":          extremes.MaxProfit,
+		"minProfit":          extremes.MinProfit,
+		"categoryStats":      categoryStats, // per kategori (line item), dalam range
+		"range": fiber.Map{
+			"from":        r.from.Format("2006-01-02"),
+			"to":          r.to.Format("2006-01-02"),
+			"granularity": r.granularity,
+		},
+		"series": series, // per bucket granularity, bucket kosong = 0
+	}, nil
 }
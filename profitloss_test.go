@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Baris id 7 milik organisasi A (user A). Semua request dikirim sebagai user B
+// di organisasi B: query harus dibatasi organization_id B sehingga database
+// tidak menemukan baris (404), dan tidak ada statement lain yang menyentuh baris itu.
+const (
+	tenantUserA = 1
+	tenantOrgA  = 10
+	tenantUserB = 2
+	tenantOrgB  = 20
+	tenantRowID = 7
+)
+
+func TestProfitLossCrossTenant(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "getProfitLossByID",
+			method: "GET",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(q("FROM profit_losses WHERE id = ? AND organization_id = ?")).
+					WithArgs("7", tenantOrgB).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "date", "revenue", "expense", "profitloss"}))
+			},
+		},
+		{
+			name:   "updateProfitLoss",
+			method: "PUT",
+			body:   `{"date":"2025-01-02","revenue":1000,"expense":0}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				// item baris A tidak terlihat dari organisasi B (bukan 400 "entry has line items")
+				mock.ExpectQuery(q("WHERE i.profit_loss_id = ? AND pl.organization_id = ?")).
+					WithArgs(tenantRowID, tenantOrgB).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectBegin()
+				mock.ExpectExec(q("UPDATE profit_losses SET date=?, revenue=?, expense=?, profitloss=? WHERE id=? AND organization_id=?")).
+					WithArgs("2025-01-02", 1000.0, 0.0, 1000.0, "7", tenantOrgB).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:   "deleteProfitLoss",
+			method: "DELETE",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(q("DELETE FROM profit_losses WHERE id=? AND organization_id=?")).
+					WithArgs("7", tenantOrgB).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDB(t)
+			tt.expect(mock)
+
+			app := newTestApp(tenantUserB, tenantOrgB, orgRoleOwner)
+			app.Get("/api/profitloss/:id", getProfitLossByID)
+			app.Put("/api/profitloss/:id", updateProfitLoss)
+			app.Delete("/api/profitloss/:id", deleteProfitLoss)
+
+			resp, body := doRequest(t, app, tt.method, "/api/profitloss/7", tt.body)
+			if resp.StatusCode != 404 {
+				t.Fatalf("status = %d, want 404 (body %s)", resp.StatusCode, body)
+			}
+
+			// baris masih utuh untuk pemiliknya
+			mock.ExpectQuery(q("FROM profit_losses WHERE id = ? AND organization_id = ?")).
+				WithArgs("7", tenantOrgA).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "date", "revenue", "expense", "profitloss"}).
+					AddRow(tenantRowID, tenantUserA, tenantOrgA, "2025-01-01", 500.0, 200.0, 300.0))
+			mock.ExpectQuery(q("FROM profit_loss_items i")).
+				WithArgs(tenantRowID).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "category_id", "name", "type", "amount", "note"}))
+
+			owner := newTestApp(tenantUserA, tenantOrgA, orgRoleOwner)
+			owner.Get("/api/profitloss/:id", getProfitLossByID)
+			resp, body = doRequest(t, owner, "GET", "/api/profitloss/7", "")
+			if resp.StatusCode != 200 || !strings.Contains(body, `"date":"2025-01-01","revenue":500`) {
+				t.Fatalf("owner read: status %d body %s", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestProfitLossListCursorMismatch(t *testing.T) {
+	base := &ProfitLossListRequest{Sort: "date", Direction: "desc", AmountField: "profitloss"}
+	cursor := encodeListCursor(listCursor{Value: "2025-01-01", ID: 7, Sort: "date", Direction: "desc", Filter: listFilterKey(base)})
+
+	app := newTestApp(tenantUserA, tenantOrgA, orgRoleOwner)
+	app.Post("/api/profitloss/list", getAllProfitLoss)
+
+	for _, body := range []string{
+		`{"cursor":"` + cursor + `","sort":"revenue"}`,
+		`{"cursor":"` + cursor + `","direction":"asc"}`,
+		`{"cursor":"` + cursor + `","from":"2025-01-01"}`,
+	} {
+		mock := newMockDB(t)
+		mock.ExpectQuery(q("SELECT COUNT(*) FROM profit_losses")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		resp, out := doRequest(t, app, "POST", "/api/profitloss/list", body)
+		if resp.StatusCode != 400 || !strings.Contains(out, "cursor does not match request") {
+			t.Errorf("%s: status %d body %s", body, resp.StatusCode, out)
+		}
+	}
+
+	// request yang sama dengan cursor -> halaman berikutnya
+	mock := newMockDB(t)
+	mock.ExpectQuery(q("SELECT COUNT(*) FROM profit_losses")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(q("AND (date < ? OR (date = ? AND id < ?))")).
+		WithArgs(tenantOrgA, "2025-01-01", "2025-01-01", 7, defaultListLimit+1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "revenue", "expense", "profitloss"}))
+	resp, out := doRequest(t, app, "POST", "/api/profitloss/list", `{"cursor":"`+cursor+`"}`)
+	if resp.StatusCode != 200 || !strings.Contains(out, `"next_cursor":""`) {
+		t.Fatalf("status %d body %s", resp.StatusCode, out)
+	}
+}
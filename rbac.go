@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Role bawaan (users.role_id)
+const (
+	roleSuperadmin = 1
+	roleAdmin      = 2
+	roleMember     = 3
+	roleViewer     = 4
+)
+
+// Permission yang dicek oleh requirePermission
+const (
+	permProfitLossRead  = "profitloss.read"
+	permProfitLossWrite = "profitloss.write"
+	permTicketRead      = "ticket.read"
+	permTicketWrite     = "ticket.write"
+	permUsersManage     = "users.manage"
+	permOutboxManage    = "outbox.manage"
+	permEntitlements    = "entitlements.manage"
+
+	// hanya dicek terhadap role di organisasi (lihat orgRolePermissions)
+	permMembersManage = "members.manage"
+)
+
+type Role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type AdminUser struct {
+	ID           int    `json:"id"`
+	RoleID       int    `json:"role_id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Organization string `json:"organization"`
+	IsActive     bool   `json:"is_active"`
+}
+
+// =======================================
+// MIDDLEWARE: cek permission role user
+// =======================================
+// dipasang setelah authRequired (dan orgContext untuk route data);
+// permission data juga harus diizinkan role user di organisasi aktif
+// dan scope API key kalau request memakai API key
+func requirePermission(perm string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ok, err := userHasPermission(currentUserID(c), perm)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if orgRole, inOrg := c.Locals(localsOrgRole).(string); ok && inOrg && orgScopedPermissions[perm] {
+			ok = orgRolePermissions[orgRole][perm]
+		}
+		// request dengan API key juga dibatasi scope key-nya
+		if key := currentAPIKey(c); ok && key != nil {
+			ok = key.scopes[permissionScopes[perm]]
+		}
+		if !ok {
+			return c.Status(403).JSON(fiber.Map{"error": "forbidden", "permission": perm})
+		}
+		return c.Next()
+	}
+}
+
+func userHasPermission(userID int, perm string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM users u
+		JOIN role_permissions rp ON rp.role_id = u.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE u.id = ? AND p.name = ?
+	`, userID, perm).Scan(&count)
+	return count > 0, err
+}
+
+// =======================================
+// ADMIN: list roles + permission
+// =======================================
+func getRoles(c *fiber.Ctx) error {
+	rows, err := db.Query(`
+		SELECT r.id, r.name, COALESCE(p.name, '')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.id, p.name
+	`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var (
+			id         int
+			name, perm string
+		)
+		if err := rows.Scan(&id, &name, &perm); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if len(roles) == 0 || roles[len(roles)-1].ID != id {
+			roles = append(roles, Role{ID: id, Name: name, Permissions: []string{}})
+		}
+		if perm != "" {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, perm)
+		}
+	}
+	return c.JSON(roles)
+}
+
+// =======================================
+// ADMIN: list users
+// =======================================
+func getAdminUsers(c *fiber.Ctx) error {
+	rows, err := db.Query(`
+		SELECT id, role_id, name, email, organization, is_active
+		FROM users
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer rows.Close()
+
+	var users []AdminUser
+	for rows.Next() {
+		var u AdminUser
+		if err := rows.Scan(&u.ID, &u.RoleID, &u.Name, &u.Email, &u.Organization, &u.IsActive); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		users = append(users, u)
+	}
+	return c.JSON(users)
+}
+
+// =======================================
+// ADMIN: ganti role user
+// =======================================
+func updateUserRole(c *fiber.Ctx) error {
+	id := atoi(c.Params("id"))
+	req := new(struct {
+		RoleID int `json:"role_id"`
+	})
+	if err := c.BodyParser(req); err != nil || req.RoleID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	callerID := currentUserID(c)
+	if id == callerID {
+		return c.Status(400).JSON(fiber.Map{"error": "cannot change your own role"})
+	}
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM roles WHERE id = ?", req.RoleID).Scan(&exists); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if exists == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown role"})
+	}
+
+	// siapa yang boleh mengubah role diatur lewat permission users.manage
+	// (superadmin saja, migrasi 0018), jadi tidak dicek ulang di sini
+	if err := execOwned("UPDATE users SET role_id = ? WHERE id = ?", req.RoleID, id); err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "role updated", "id": id, "role_id": req.RoleID})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// =======================================
+// HELPER: Issue access + refresh token
+// =======================================
+// family kosong berarti sesi baru (login); saat rotasi family lama diteruskan
+func issueSession(c *fiber.Ctx, ex dbtx, userID int, family string) (fiber.Map, error) {
+	var err error
+	if family == "" {
+		family, err = generateSecureToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshToken, err := generateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshExpiresAt := time.Now().Add(refreshTokenTTL)
+
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	_, err = ex.Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, user_agent, ip_address, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, family, hashToken(refreshToken), userAgent, c.IP(), refreshExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := userTokenVersion(ex, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, expiresAt, err := signToken(userID, tokenTypeAccess, version, accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"token":              accessToken,
+		"token_type":         "Bearer",
+		"expires_at":         expiresAt,
+		"refresh_token":      refreshToken,
+		"refresh_expires_at": refreshExpiresAt,
+	}, nil
+}
+
+// =======================================
+// HELPER: Akhiri semua sesi user
+// =======================================
+// refresh token dicabut; token_version naik supaya access token yang sudah terbit ikut ditolak
+func revokeAllSessions(ex execer, userID int) error {
+	_, err := ex.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		time.Now(), userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec("UPDATE users SET token_version = token_version + 1 WHERE id = ?", userID)
+	return err
+}
+
+// =======================================
+// REFRESH TOKEN PROCESS (rotasi)
+// =======================================
+func refreshTokenProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		RefreshToken string `json:"refresh_token"`
+	})
+	if err := c.BodyParser(req); err != nil || req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var (
+		id        int
+		userID    int
+		family    string
+		revokedAt sql.NullString
+		expired   bool
+		isActive  bool
+	)
+
+	// Lock baris token supaya dua request paralel tidak sama-sama berhasil rotasi
+	err = tx.QueryRow(`
+		SELECT rt.id, rt.user_id, rt.family_id, rt.revoked_at, rt.expires_at <= ?, u.is_active
+		FROM refresh_tokens rt
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = ?
+		FOR UPDATE
+	`, time.Now(), hashToken(req.RefreshToken)).Scan(&id, &userID, &family, &revokedAt, &expired, &isActive)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid refresh token"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Token lama dipakai lagi: anggap bocor, cabut seluruh family
+	if revokedAt.Valid {
+		_, err = tx.Exec(
+			"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+			time.Now(), family,
+		)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := tx.Commit(); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(401).JSON(fiber.Map{"error": "refresh token reuse detected, please login again"})
+	}
+
+	if expired {
+		return c.Status(401).JSON(fiber.Map{"error": "refresh token expired"})
+	}
+	if !isActive {
+		return c.Status(403).JSON(fiber.Map{"error": "user not active"})
+	}
+
+	// Cabut token yang sekarang, terbitkan yang baru di family yang sama
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ?", time.Now(), id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	session, err := issueSession(c, tx, userID, family)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(session)
+}
+
+// =======================================
+// LOGOUT (sesi ini saja)
+// =======================================
+func logoutProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		RefreshToken string `json:"refresh_token"`
+	})
+	if err := c.BodyParser(req); err != nil || req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	var family string
+	err := db.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash = ?", hashToken(req.RefreshToken)).Scan(&family)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// token tidak dikenal, anggap sudah logout
+			return c.JSON(fiber.Map{"message": "logged out"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	_, err = db.Exec(
+		"UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL",
+		time.Now(), family,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "logged out"})
+}
+
+// =======================================
+// LOGOUT ALL DEVICES
+// =======================================
+func logoutAllProcess(c *fiber.Ctx) error {
+	if err := revokeAllSessions(db, currentUserID(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "logged out from all devices"})
+}
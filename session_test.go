@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testRefreshToken = "refresh-token-lama"
+
+var refreshColumns = []string{"id", "user_id", "family_id", "revoked_at", "expired", "is_active"}
+
+// token valid: token lama dicabut, token baru terbit di family yang sama
+func TestRefreshTokenRotation(t *testing.T) {
+	setTestTokenConfig(t)
+	mock := newMockDB(t)
+
+	newHash := &captureArg{}
+	mock.ExpectBegin()
+	mock.ExpectQuery(q("FROM refresh_tokens rt")).
+		WithArgs(sqlmock.AnyArg(), hashToken(testRefreshToken)).
+		WillReturnRows(sqlmock.NewRows(refreshColumns).AddRow(3, tenantUserA, "fam-1", nil, false, true))
+	mock.ExpectExec(q("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ?")).
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("INSERT INTO refresh_tokens")).
+		WithArgs(tenantUserA, "fam-1", newHash, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectQuery(q("SELECT token_version FROM users WHERE id = ?")).
+		WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(2))
+	mock.ExpectCommit()
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/refresh", refreshTokenProcess)
+
+	resp, body := doRequest(t, app, "POST", "/api/refresh", `{"refresh_token":"`+testRefreshToken+`"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.RefreshToken == testRefreshToken || hashToken(out.RefreshToken) != newHash.value {
+		t.Errorf("refresh token not rotated: %s", body)
+	}
+	claims, err := parseToken(out.Token, tokenTypeAccess)
+	if err != nil || claims.Sub != tenantUserA || claims.Ver != 2 {
+		t.Errorf("access token claims = %+v, err %v", claims, err)
+	}
+}
+
+// token yang sudah dicabut dipakai lagi: seluruh family dicabut, tidak ada token baru
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	mock := newMockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(q("FROM refresh_tokens rt")).
+		WithArgs(sqlmock.AnyArg(), hashToken(testRefreshToken)).
+		WillReturnRows(sqlmock.NewRows(refreshColumns).AddRow(3, tenantUserA, "fam-1", "2025-03-01 10:00:00", false, true))
+	mock.ExpectExec(q("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), "fam-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/refresh", refreshTokenProcess)
+
+	resp, body := doRequest(t, app, "POST", "/api/refresh", `{"refresh_token":"`+testRefreshToken+`"}`)
+	if resp.StatusCode != 401 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		row    []driver.Value
+		status int
+	}{
+		{"expired", []driver.Value{3, tenantUserA, "fam-1", nil, true, true}, 401},
+		{"inactive user", []driver.Value{3, tenantUserA, "fam-1", nil, false, false}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(q("FROM refresh_tokens rt")).
+				WillReturnRows(sqlmock.NewRows(refreshColumns).AddRow(tt.row...))
+			mock.ExpectRollback()
+
+			app := newTestApp(0, 0, "")
+			app.Post("/api/refresh", refreshTokenProcess)
+
+			resp, body := doRequest(t, app, "POST", "/api/refresh", `{"refresh_token":"`+testRefreshToken+`"}`)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d body %s, want %d", resp.StatusCode, body, tt.status)
+			}
+		})
+	}
+}
+
+// ganti password: semua refresh token dicabut + token_version naik, pemanggil dapat sesi baru
+func TestChangePasswordRevokesSessions(t *testing.T) {
+	setTestTokenConfig(t)
+	mock := newMockDB(t)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password-lama-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(q("SELECT password, email, name FROM users WHERE id = ?")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"password", "email", "name"}).AddRow(string(hashed), "budi@example.com", "Budi"))
+	mock.ExpectBegin()
+	mock.ExpectExec(q("UPDATE users SET password = ? WHERE id = ?")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), tenantUserA).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(q("UPDATE users SET token_version = token_version + 1 WHERE id = ?")).
+		WithArgs(tenantUserA).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("INSERT INTO refresh_tokens")).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectQuery(q("SELECT token_version FROM users WHERE id = ?")).
+		WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(4))
+	mock.ExpectCommit()
+
+	app := newTestApp(tenantUserA, 0, "")
+	app.Post("/api/change-password", changePasswordProcess)
+
+	resp, body := doRequest(t, app, "POST", "/api/change-password",
+		`{"currentPassword":"password-lama-1","newPassword":"kata-sandi-baru-77"}`)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := parseToken(out.Token, tokenTypeAccess); err != nil || claims.Ver != 4 {
+		t.Errorf("new access token claims = %+v, err %v", claims, err)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Granularity bucket stats
+const (
+	granularityDay     = "day"
+	granularityWeek    = "week"
+	granularityMonth   = "month"
+	granularityQuarter = "quarter"
+	granularityYear    = "year"
+)
+
+// batas jumlah bucket per request supaya range harian tidak kebablasan
+const maxStatsBuckets = 4000
+
+var errInvalidStatsRange = errors.New("invalid from/to or granularity")
+
+// satu bucket di series stats
+type StatsBucket struct {
+	Period       string  `json:"period"` // label, mis. "2025-01-31", "2025-W05", "January 2025", "Q1 2025", "2025"
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	Revenue      float64 `json:"revenue"`
+	Expense      float64 `json:"expense"`
+	ProfitLoss   float64 `json:"profitloss"`
+	ProfitMargin float64 `json:"profitMargin"`
+}
+
+// range stats hasil validasi StatsRequest
+type statsRange struct {
+	from, to    time.Time
+	granularity string
+}
+
+// default: granularity bulanan, tahun berjalan (sama seperti monthlyStats)
+func parseStatsRange(req StatsRequest, now time.Time) (statsRange, error) {
+	r := statsRange{granularity: req.Granularity}
+	if r.granularity == "" {
+		r.granularity = granularityMonth
+	}
+	switch r.granularity {
+	case granularityDay, granularityWeek, granularityMonth, granularityQuarter, granularityYear:
+	default:
+		return r, errInvalidStatsRange
+	}
+
+	var err error
+	r.to = time.Date(now.Year(), time.December, 31, 0, 0, 0, 0, time.UTC)
+	if req.To != "" {
+		if r.to, err = time.Parse("2006-01-02", req.To); err != nil {
+			return r, errInvalidStatsRange
+		}
+	}
+	r.from = time.Date(r.to.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	if req.From != "" {
+		if r.from, err = time.Parse("2006-01-02", req.From); err != nil {
+			return r, errInvalidStatsRange
+		}
+	}
+	if r.from.After(r.to) {
+		return r, errInvalidStatsRange
+	}
+
+	n := 0
+	for t := bucketStart(r.from, r.granularity); !t.After(r.to); t = nextBucket(t, r.granularity) {
+		if n++; n > maxStatsBuckets {
+			return r, fmt.Errorf("%w: too many buckets (max %d)", errInvalidStatsRange, maxStatsBuckets)
+		}
+	}
+	return r, nil
+}
+
+// awal bucket yang memuat t (minggu mulai Senin, sesuai ISO week)
+func bucketStart(t time.Time, granularity string) time.Time {
+	y, m, d := t.Date()
+	switch granularity {
+	case granularityWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC)
+	case granularityMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	case granularityQuarter:
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case granularityYear:
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case granularityWeek:
+		return start.AddDate(0, 0, 7)
+	case granularityMonth:
+		return start.AddDate(0, 1, 0)
+	case granularityQuarter:
+		return start.AddDate(0, 3, 0)
+	case granularityYear:
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func bucketLabel(start time.Time, granularity string) string {
+	switch granularity {
+	case granularityWeek:
+		y, w := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	case granularityMonth:
+		return start.Format("January 2006")
+	case granularityQuarter:
+		return fmt.Sprintf("Q%d %d", (int(start.Month())-1)/3+1, start.Year())
+	case granularityYear:
+		return start.Format("2006")
+	}
+	return start.Format("2006-01-02")
+}
+
+// semua bucket dalam range, diisi nol (bucket pertama/terakhir dipotong ke from/to)
+func emptyBuckets(r statsRange) ([]StatsBucket, map[string]int) {
+	var buckets []StatsBucket
+	index := map[string]int{}
+	for t := bucketStart(r.from, r.granularity); !t.After(r.to); t = nextBucket(t, r.granularity) {
+		start, end := t, nextBucket(t, r.granularity).AddDate(0, 0, -1)
+		if start.Before(r.from) {
+			start = r.from
+		}
+		if end.After(r.to) {
+			end = r.to
+		}
+		label := bucketLabel(t, r.granularity)
+		index[label] = len(buckets)
+		buckets = append(buckets, StatsBucket{
+			Period: label,
+			Start:  start.Format("2006-01-02"),
+			End:    end.Format("2006-01-02"),
+		})
+	}
+	return buckets, index
+}
+
+// label bulan ("January 2006") dalam range, untuk breakdown kategori
+func monthLabels(r statsRange) []string {
+	var labels []string
+	for t := bucketStart(r.from, granularityMonth); !t.After(r.to); t = nextBucket(t, granularityMonth) {
+		labels = append(labels, bucketLabel(t, granularityMonth))
+	}
+	return labels
+}
+
+func fillMargins(buckets []StatsBucket) {
+	for i := range buckets {
+		if buckets[i].Revenue > 0 {
+			buckets[i].ProfitMargin = buckets[i].ProfitLoss / buckets[i].Revenue * 100
+		}
+	}
+}
+
+// =======================================
+// HELPER: agregasi stats di SQL (GROUP BY, pakai index organization_id+date)
+// =======================================
+
+// ekspresi awal bucket dari kolom date, hasilnya 'YYYY-MM-DD'
+var bucketStartSQL = map[string]string{
+	granularityDay:     "date",
+	granularityWeek:    "DATE_SUB(date, INTERVAL WEEKDAY(date) DAY)",
+	granularityMonth:   "DATE_FORMAT(date, '%Y-%m-01')",
+	granularityQuarter: "MAKEDATE(YEAR(date), 1) + INTERVAL (QUARTER(date) - 1) QUARTER",
+	granularityYear:    "DATE_FORMAT(date, '%Y-01-01')",
+}
+
+// total per bucket dalam range, bucket kosong tetap 0
+func sumBuckets(orgID int, r statsRange) ([]StatsBucket, error) {
+	buckets, index := emptyBuckets(r)
+	rows, err := db.Query(`
+		SELECT `+bucketStartSQL[r.granularity]+` AS bucket, SUM(revenue), SUM(expense), SUM(profitloss)
+		FROM profit_losses
+		WHERE organization_id = ? AND date BETWEEN ? AND ?
+		GROUP BY bucket
+	`, orgID, r.from.Format("2006-01-02"), r.to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			start                     string
+			revenue, expense, profits float64
+		)
+		if err := rows.Scan(&start, &revenue, &expense, &profits); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[bucketLabel(t, r.granularity)]
+		if !ok {
+			continue
+		}
+		buckets[i].Revenue += revenue
+		buckets[i].Expense += expense
+		buckets[i].ProfitLoss += profits
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	fillMargins(buckets)
+	return buckets, nil
+}
+
+// total per tahun (semua tahun yang ada datanya)
+func sumYears(orgID int) ([]StatsBucket, error) {
+	rows, err := db.Query(`
+		SELECT YEAR(date), SUM(revenue), SUM(expense), SUM(profitloss)
+		FROM profit_losses
+		WHERE organization_id = ?
+		GROUP BY YEAR(date)
+		ORDER BY YEAR(date)
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	years := []StatsBucket{}
+	for rows.Next() {
+		var (
+			year int
+			b    StatsBucket
+		)
+		if err := rows.Scan(&year, &b.Revenue, &b.Expense, &b.ProfitLoss); err != nil {
+			return nil, err
+		}
+		b.Period = strconv.Itoa(year)
+		b.Start = fmt.Sprintf("%04d-01-01", year)
+		b.End = fmt.Sprintf("%04d-12-31", year)
+		years = append(years, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	fillMargins(years)
+	return years, nil
+}
+
+// min/max per baris (harian) sepanjang waktu, semantik sama dengan versi lama:
+// max mulai dari 0 dan min dari 999999, jadi max tidak pernah < 0 dan min tidak pernah > 999999
+type statsExtremes struct {
+	Count                  int
+	MinRevenue, MaxRevenue float64
+	MinExpense, MaxExpense float64
+	MinProfit, MaxProfit   float64
+}
+
+func rowExtremes(orgID int) (statsExtremes, error) {
+	var e statsExtremes
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+			LEAST(COALESCE(MIN(revenue), 999999), 999999), GREATEST(COALESCE(MAX(revenue), 0), 0),
+			LEAST(COALESCE(MIN(expense), 999999), 999999), GREATEST(COALESCE(MAX(expense), 0), 0),
+			LEAST(COALESCE(MIN(profitloss), 999999), 999999), GREATEST(COALESCE(MAX(profitloss), 0), 0)
+		FROM profit_losses
+		WHERE organization_id = ?
+	`, orgID).Scan(&e.Count, &e.MinRevenue, &e.MaxRevenue, &e.MinExpense, &e.MaxExpense, &e.MinProfit, &e.MaxProfit)
+	return e, err
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Perbandingan /api/profitloss/stats untuk organisasi dengan ~10 tahun data harian:
+//   - InGo:    cara lama, ambil seluruh histori lalu agregasi di Go
+//   - GroupBy: buildProfitLossStats, MySQL mengirim hasil GROUP BY saja
+//
+// Database diganti sqlmock, jadi yang diukur adalah baris yang harus dibaca +
+// kerja Go + encode JSON, bukan biaya query di MySQL.
+//
+//	go test -run '^$' -bench ProfitLossStats -benchmem
+//
+// BenchmarkProfitLossStatsMySQL mengukur keduanya di MySQL asli. Pakai database kosong
+// khusus benchmark: tabel dibuat kalau belum ada, baris organisasi benchmark dihapus lagi.
+//
+//	STATS_BENCH_DSN='user:pass@tcp(127.0.0.1:3306)/stats_bench?clientFoundRows=true' \
+//		go test -run '^$' -bench ProfitLossStatsMySQL -benchmem
+const benchStatsDays = 3650
+
+// organisasi khusus benchmark MySQL
+const benchStatsOrgID = 990001
+
+var benchStatsNow = time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func benchStatsSeed() []ProfitLoss {
+	rows := make([]ProfitLoss, 0, benchStatsDays)
+	start := benchStatsNow.AddDate(0, 0, -benchStatsDays+1)
+	for i := 0; i < benchStatsDays; i++ {
+		revenue := float64(1000000 + (i*7919)%500000)
+		expense := float64(600000 + (i*104729)%400000)
+		rows = append(rows, ProfitLoss{
+			ID:         i + 1,
+			Date:       start.AddDate(0, 0, i).Format("2006-01-02"),
+			Revenue:    revenue,
+			Expense:    expense,
+			ProfitLoss: revenue - expense,
+		})
+	}
+	return rows
+}
+
+func newBenchMockDB(b *testing.B) sqlmock.Sqlmock {
+	b.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	prev := db
+	db = mockDB
+	b.Cleanup(func() {
+		db = prev
+		mockDB.Close()
+	})
+	return mock
+}
+
+func plRows(seed []ProfitLoss, from, to time.Time) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "date", "revenue", "expense", "profitloss"})
+	for _, pl := range seed {
+		t, _ := time.Parse("2006-01-02", pl.Date)
+		if !t.Before(from) && !t.After(to) {
+			rows.AddRow(pl.ID, pl.Date, pl.Revenue, pl.Expense, pl.ProfitLoss)
+		}
+	}
+	return rows
+}
+
+// hasil GROUP BY yang akan dikirim MySQL untuk range + granularity r
+func groupedRows(seed []ProfitLoss, r statsRange) *sqlmock.Rows {
+	var (
+		keys []string
+		sums = map[string][3]float64{}
+	)
+	for _, pl := range seed {
+		t, _ := time.Parse("2006-01-02", pl.Date)
+		if t.Before(r.from) || t.After(r.to) {
+			continue
+		}
+		key := bucketStart(t, r.granularity).Format("2006-01-02")
+		s, ok := sums[key]
+		if !ok {
+			keys = append(keys, key)
+		}
+		sums[key] = [3]float64{s[0] + pl.Revenue, s[1] + pl.Expense, s[2] + pl.ProfitLoss}
+	}
+	rows := sqlmock.NewRows([]string{"bucket", "revenue", "expense", "profitloss"})
+	for _, k := range keys {
+		rows.AddRow(k, sums[k][0], sums[k][1], sums[k][2])
+	}
+	return rows
+}
+
+func yearRows(seed []ProfitLoss) *sqlmock.Rows {
+	var (
+		years []int
+		sums  = map[int][3]float64{}
+	)
+	for _, pl := range seed {
+		t, _ := time.Parse("2006-01-02", pl.Date)
+		s, ok := sums[t.Year()]
+		if !ok {
+			years = append(years, t.Year())
+		}
+		sums[t.Year()] = [3]float64{s[0] + pl.Revenue, s[1] + pl.Expense, s[2] + pl.ProfitLoss}
+	}
+	rows := sqlmock.NewRows([]string{"year", "revenue", "expense", "profitloss"})
+	for _, y := range years {
+		rows.AddRow(y, sums[y][0], sums[y][1], sums[y][2])
+	}
+	return rows
+}
+
+func extremesRow(seed []ProfitLoss) *sqlmock.Rows {
+	e := []float64{999999, 0, 999999, 0, 999999, 0}
+	for _, pl := range seed {
+		for i, v := range []float64{pl.Revenue, pl.Expense, pl.ProfitLoss} {
+			e[2*i] = min(e[2*i], v)
+			e[2*i+1] = max(e[2*i+1], v)
+		}
+	}
+	values := []driver.Value{len(seed)}
+	for _, v := range e {
+		values = append(values, v)
+	}
+	return sqlmock.NewRows([]string{"count", "min_revenue", "max_revenue", "min_expense", "max_expense", "min_profit", "max_profit"}).
+		AddRow(values...)
+}
+
+func BenchmarkProfitLossStatsInGo(b *testing.B) {
+	seed := benchStatsSeed()
+	r, err := parseStatsRange(StatsRequest{}, benchStatsNow)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mock := newBenchMockDB(b)
+	all := statsRange{from: time.Time{}, to: benchStatsNow}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		mock.ExpectQuery(q("FROM profit_losses")).WillReturnRows(plRows(seed, all.from, all.to))
+		b.StartTimer()
+
+		out, err := inGoProfitLossStats(tenantOrgA, r, benchStatsNow)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := json.Marshal(out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProfitLossStatsGroupBy(b *testing.B) {
+	seed := benchStatsSeed()
+	r, err := parseStatsRange(StatsRequest{}, benchStatsNow)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mock := newBenchMockDB(b)
+	firstDay := time.Date(benchStatsNow.Year(), benchStatsNow.Month(), 1, 0, 0, 0, 0, time.UTC)
+	firstOfYear := time.Date(benchStatsNow.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		mock.ExpectQuery(q("GROUP BY bucket")).WillReturnRows(groupedRows(seed, statsRange{from: firstDay, to: firstDay.AddDate(0, 1, -1), granularity: granularityDay}))
+		mock.ExpectQuery(q("GROUP BY bucket")).WillReturnRows(groupedRows(seed, statsRange{from: firstOfYear, to: firstOfYear.AddDate(1, 0, -1), granularity: granularityMonth}))
+		mock.ExpectQuery(q("GROUP BY YEAR(date)")).WillReturnRows(yearRows(seed))
+		mock.ExpectQuery(q("GROUP BY bucket")).WillReturnRows(groupedRows(seed, r))
+		mock.ExpectQuery(q("SELECT COUNT(*),")).WillReturnRows(extremesRow(seed))
+		mock.ExpectQuery(q("SELECT id, date, revenue, expense, profitloss")).WillReturnRows(plRows(seed, r.from, r.to))
+		mock.ExpectQuery(q("FROM profit_loss_items i")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "type", "month", "amount"}))
+		b.StartTimer()
+
+		out, err := buildProfitLossStats(tenantOrgA, r, benchStatsNow)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := json.Marshal(out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProfitLossStatsMySQL(b *testing.B) {
+	dsn := getEnv("STATS_BENCH_DSN", "")
+	if dsn == "" {
+		b.Skip("STATS_BENCH_DSN not set")
+	}
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	prev := db
+	db = conn
+	b.Cleanup(func() {
+		db = prev
+		conn.Close()
+	})
+	seedBenchMySQL(b)
+
+	r, err := parseStatsRange(StatsRequest{}, benchStatsNow)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// min/max GROUP BY harus sama dengan loop lama
+	oldStats, err := inGoProfitLossStats(benchStatsOrgID, r, benchStatsNow)
+	if err != nil {
+		b.Fatal(err)
+	}
+	newStats, err := buildProfitLossStats(benchStatsOrgID, r, benchStatsNow)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, k := range []string{"minRevenue", "maxRevenue", "minExpense", "maxExpense", "minProfit", "maxProfit"} {
+		if oldStats[k] != newStats[k] {
+			b.Fatalf("%s: in Go %v, GROUP BY %v", k, oldStats[k], newStats[k])
+		}
+	}
+
+	for _, bm := range []struct {
+		name  string
+		stats func(orgID int, r statsRange, now time.Time) (fiber.Map, error)
+	}{
+		{"InGo", inGoProfitLossStats},
+		{"GroupBy", buildProfitLossStats},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				out, err := bm.stats(benchStatsOrgID, r, benchStatsNow)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := json.Marshal(out); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// tabel profit_losses lama tidak dibuat migrasi, jadi dibuat di sini (kolom yang dipakai stats saja)
+func seedBenchMySQL(b *testing.B) {
+	b.Helper()
+	stmts := []string{`
+		CREATE TABLE IF NOT EXISTS profit_losses (
+			id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			user_id BIGINT UNSIGNED NOT NULL,
+			organization_id BIGINT UNSIGNED NULL,
+			date DATE NOT NULL,
+			revenue DECIMAL(15,2) NOT NULL,
+			expense DECIMAL(15,2) NOT NULL,
+			profitloss DECIMAL(15,2) NOT NULL,
+			UNIQUE KEY uq_profit_losses_org_date (organization_id, date)
+		)`,
+	}
+	for _, m := range migrations {
+		if m.id == "0016_create_categories_and_items" {
+			stmts = append(stmts, m.stmts...)
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	cleanup := func() {
+		if _, err := db.Exec("DELETE FROM profit_losses WHERE organization_id = ?", benchStatsOrgID); err != nil {
+			b.Error(err)
+		}
+	}
+	cleanup()
+	b.Cleanup(cleanup)
+
+	seed := benchStatsSeed()
+	for start := 0; start < len(seed); start += 500 {
+		end := min(start+500, len(seed))
+		query := "INSERT INTO profit_losses (user_id, organization_id, date, revenue, expense, profitloss) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(0, ?, ?, ?, ?, ?),", end-start), ",")
+		args := make([]any, 0, 5*(end-start))
+		for _, pl := range seed[start:end] {
+			args = append(args, benchStatsOrgID, pl.Date, pl.Revenue, pl.Expense, pl.ProfitLoss)
+		}
+		if _, err := db.Exec(query, args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Agregasi lama (sebelum GROUP BY): seluruh histori dibaca lalu dijumlah di Go.
+// Loop per baris sama dengan versi lama; pengisian bucket kosong untuk output lama tidak ikut disalin.
+func inGoProfitLossStats(orgID int, r statsRange, now time.Time) (fiber.Map, error) {
+	series, seriesIndex := emptyBuckets(r)
+
+	rows, err := db.Query(`
+		SELECT id, date, revenue, expense, profitloss
+		FROM profit_losses
+		WHERE organization_id = ?
+		ORDER BY date ASC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []ProfitLoss
+	dailyRevenue := make(map[string]float64)
+	dailyExpense := make(map[string]float64)
+	dailyProfitloss := make(map[string]float64)
+	monthlyRevenue := make(map[string]float64)
+	monthlyExpense := make(map[string]float64)
+	monthlyProfitloss := make(map[string]float64)
+	yearlyRevenue := make(map[string]float64)
+	yearlyExpense := make(map[string]float64)
+	yearlyProfitloss := make(map[string]float64)
+
+	var maxRevenue, maxExpense, maxProfit float64
+	minRevenue, minExpense, minProfit := 999999.0, 999999.0, 999999.0
+
+	currentYear, currentMonth, _ := now.Date()
+	firstDay := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, now.Location())
+	lastDay := firstDay.AddDate(0, 1, -1)
+
+	for rows.Next() {
+		var pl ProfitLoss
+		if err := rows.Scan(&pl.ID, &pl.Date, &pl.Revenue, &pl.Expense, &pl.ProfitLoss); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", pl.Date)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pl)
+
+		if !t.Before(r.from) && !t.After(r.to) {
+			b := &series[seriesIndex[bucketLabel(bucketStart(t, r.granularity), r.granularity)]]
+			b.Revenue += pl.Revenue
+			b.Expense += pl.Expense
+			b.ProfitLoss += pl.ProfitLoss
+		}
+		if !t.Before(firstDay) && !t.After(lastDay) {
+			dayKey := t.Format("2006-01-02")
+			dailyRevenue[dayKey] += pl.Revenue
+			dailyExpense[dayKey] += pl.Expense
+			dailyProfitloss[dayKey] += pl.ProfitLoss
+		}
+		if t.Year() == currentYear {
+			monthKey := t.Format("January 2006")
+			monthlyRevenue[monthKey] += pl.Revenue
+			monthlyExpense[monthKey] += pl.Expense
+			monthlyProfitloss[monthKey] += pl.ProfitLoss
+		}
+		yearKey := t.Format("2006")
+		yearlyRevenue[yearKey] += pl.Revenue
+		yearlyExpense[yearKey] += pl.Expense
+		yearlyProfitloss[yearKey] += pl.ProfitLoss
+
+		maxRevenue, minRevenue = max(maxRevenue, pl.Revenue), min(minRevenue, pl.Revenue)
+		maxExpense, minExpense = max(maxExpense, pl.Expense), min(minExpense, pl.Expense)
+		maxProfit, minProfit = max(maxProfit, pl.ProfitLoss), min(minProfit, pl.ProfitLoss)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	fillMargins(series)
+
+	yearlyProfitMargin := make(map[string]float64)
+	for year, rev := range yearlyRevenue {
+		if rev > 0 {
+			yearlyProfitMargin[year] = yearlyProfitloss[year] / rev * 100
+		}
+	}
+
+	return fiber.Map{
+		"data":               result,
+		"dailyRevenue":       dailyRevenue,
+		"dailyExpense":       dailyExpense,
+		"dailyProfitloss":    dailyProfitloss,
+		"monthlyRevenue":     monthlyRevenue,
+		"monthlyExpense":     monthlyExpense,
+		"monthlyProfitloss":  monthlyProfitloss,
+		"yearlyRevenue":      yearlyRevenue,
+		"yearlyExpense":      yearlyExpense,
+		"yearlyProfitloss":   yearlyProfitloss,
+		"yearlyProfitMargin": yearlyProfitMargin,
+		"maxRevenue":         maxRevenue,
+		"minRevenue":         minRevenue,
+		"maxExpense":         maxExpense,
+		"minExpense":         minExpense,
+		"maxProfit":          maxProfit,
+		"minProfit":          minProfit,
+		"series":             series,
+	}, nil
+}
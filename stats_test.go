@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func mustDate(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseStatsRange(t *testing.T) {
+	now := mustDate("2025-06-15")
+	tests := []struct {
+		name                  string
+		req                   StatsRequest
+		from, to, granularity string
+	}{
+		{"default tahun berjalan, bulanan", StatsRequest{}, "2025-01-01", "2025-12-31", granularityMonth},
+		{"from dan to", StatsRequest{From: "2024-03-10", To: "2024-04-20", Granularity: granularityWeek}, "2024-03-10", "2024-04-20", granularityWeek},
+		{"hanya to: from = awal tahun to", StatsRequest{To: "2023-08-31", Granularity: granularityQuarter}, "2023-01-01", "2023-08-31", granularityQuarter},
+		{"hanya from: to = akhir tahun ini", StatsRequest{From: "2022-01-01", Granularity: granularityYear}, "2022-01-01", "2025-12-31", granularityYear},
+		{"satu hari", StatsRequest{From: "2025-02-28", To: "2025-02-28", Granularity: granularityDay}, "2025-02-28", "2025-02-28", granularityDay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseStatsRange(tt.req, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.from.Format("2006-01-02"); got != tt.from {
+				t.Errorf("from = %s, want %s", got, tt.from)
+			}
+			if got := r.to.Format("2006-01-02"); got != tt.to {
+				t.Errorf("to = %s, want %s", got, tt.to)
+			}
+			if r.granularity != tt.granularity {
+				t.Errorf("granularity = %s, want %s", r.granularity, tt.granularity)
+			}
+		})
+	}
+}
+
+func TestParseStatsRangeInvalid(t *testing.T) {
+	now := mustDate("2025-06-15")
+	for name, req := range map[string]StatsRequest{
+		"granularity":       {Granularity: "hour"},
+		"format from":       {From: "01-03-2025"},
+		"format to":         {To: "2025-13-01"},
+		"from setelah to":   {From: "2025-05-02", To: "2025-05-01"},
+		"terlalu banyak":    {From: "2000-01-01", To: "2025-12-31", Granularity: granularityDay},
+		"from tanpa to":     {From: "2026-01-01"},
+		"to sebelum from":   {From: "2025-01-01", To: "2024-12-31", Granularity: granularityYear},
+		"tanggal tidak ada": {From: "2025-02-30", To: "2025-03-01"},
+	} {
+		if _, err := parseStatsRange(req, now); err == nil {
+			t.Errorf("%s: %+v accepted", name, req)
+		}
+	}
+	// tepat di batas jumlah bucket masih boleh
+	from := mustDate("2020-01-01")
+	req := StatsRequest{From: "2020-01-01", To: from.AddDate(0, 0, maxStatsBuckets-1).Format("2006-01-02"), Granularity: granularityDay}
+	if _, err := parseStatsRange(req, now); err != nil {
+		t.Errorf("%d daily buckets rejected: %v", maxStatsBuckets, err)
+	}
+}
+
+func TestBucketStartAndLabel(t *testing.T) {
+	tests := []struct {
+		day, granularity, start, label string
+	}{
+		{"2025-05-17", granularityDay, "2025-05-17", "2025-05-17"},
+		{"2025-05-17", granularityWeek, "2025-05-12", "2025-W20"}, // Sabtu -> Senin
+		{"2025-05-12", granularityWeek, "2025-05-12", "2025-W20"},
+		{"2025-05-18", granularityWeek, "2025-05-12", "2025-W20"}, // Minggu masih minggu yang sama
+		{"2025-01-01", granularityWeek, "2024-12-30", "2025-W01"}, // ISO week melewati tahun
+		{"2025-05-17", granularityMonth, "2025-05-01", "May 2025"},
+		{"2025-03-31", granularityQuarter, "2025-01-01", "Q1 2025"},
+		{"2025-05-17", granularityQuarter, "2025-04-01", "Q2 2025"},
+		{"2025-12-31", granularityQuarter, "2025-10-01", "Q4 2025"},
+		{"2025-05-17", granularityYear, "2025-01-01", "2025"},
+	}
+	for _, tt := range tests {
+		start := bucketStart(mustDate(tt.day), tt.granularity)
+		if got := start.Format("2006-01-02"); got != tt.start {
+			t.Errorf("bucketStart(%s, %s) = %s, want %s", tt.day, tt.granularity, got, tt.start)
+		}
+		if got := bucketLabel(start, tt.granularity); got != tt.label {
+			t.Errorf("bucketLabel(%s, %s) = %s, want %s", tt.start, tt.granularity, got, tt.label)
+		}
+	}
+}
+
+// bucket pertama & terakhir dipotong ke from/to
+func TestEmptyBucketsClipped(t *testing.T) {
+	tests := []struct {
+		r    statsRange
+		want []StatsBucket
+	}{
+		{statsRange{from: mustDate("2025-01-01"), to: mustDate("2025-01-15"), granularity: granularityWeek}, []StatsBucket{
+			{Period: "2025-W01", Start: "2025-01-01", End: "2025-01-05"},
+			{Period: "2025-W02", Start: "2025-01-06", End: "2025-01-12"},
+			{Period: "2025-W03", Start: "2025-01-13", End: "2025-01-15"},
+		}},
+		{statsRange{from: mustDate("2024-02-15"), to: mustDate("2024-04-10"), granularity: granularityMonth}, []StatsBucket{
+			{Period: "February 2024", Start: "2024-02-15", End: "2024-02-29"},
+			{Period: "March 2024", Start: "2024-03-01", End: "2024-03-31"},
+			{Period: "April 2024", Start: "2024-04-01", End: "2024-04-10"},
+		}},
+		{statsRange{from: mustDate("2024-11-01"), to: mustDate("2025-02-01"), granularity: granularityQuarter}, []StatsBucket{
+			{Period: "Q4 2024", Start: "2024-11-01", End: "2024-12-31"},
+			{Period: "Q1 2025", Start: "2025-01-01", End: "2025-02-01"},
+		}},
+		{statsRange{from: mustDate("2023-07-01"), to: mustDate("2024-06-30"), granularity: granularityYear}, []StatsBucket{
+			{Period: "2023", Start: "2023-07-01", End: "2023-12-31"},
+			{Period: "2024", Start: "2024-01-01", End: "2024-06-30"},
+		}},
+	}
+	for _, tt := range tests {
+		got, index := emptyBuckets(tt.r)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: %d buckets, want %d (%+v)", tt.r.granularity, len(got), len(tt.want), got)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: bucket %d = %+v, want %+v", tt.r.granularity, i, got[i], tt.want[i])
+			}
+			if index[tt.want[i].Period] != i {
+				t.Errorf("%s: index[%s] = %d, want %d", tt.r.granularity, tt.want[i].Period, index[tt.want[i].Period], i)
+			}
+		}
+	}
+}
+
+// hasil GROUP BY masuk ke bucket yang benar, bucket tanpa data tetap 0
+func TestSumBucketsQuarter(t *testing.T) {
+	mock := newMockDB(t)
+	r := statsRange{from: mustDate("2025-01-01"), to: mustDate("2025-12-31"), granularity: granularityQuarter}
+
+	mock.ExpectQuery(q("GROUP BY bucket")).
+		WithArgs(tenantOrgA, "2025-01-01", "2025-12-31").
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "revenue", "expense", "profitloss"}).
+			AddRow("2025-01-01", 1000.0, 750.0, 250.0).
+			AddRow("2025-07-01", 400.0, 500.0, -100.0))
+
+	buckets, err := sumBuckets(tenantOrgA, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StatsBucket{
+		{Period: "Q1 2025", Start: "2025-01-01", End: "2025-03-31", Revenue: 1000, Expense: 750, ProfitLoss: 250, ProfitMargin: 25},
+		{Period: "Q2 2025", Start: "2025-04-01", End: "2025-06-30"},
+		{Period: "Q3 2025", Start: "2025-07-01", End: "2025-09-30", Revenue: 400, Expense: 500, ProfitLoss: -100, ProfitMargin: -25},
+		{Period: "Q4 2025", Start: "2025-10-01", End: "2025-12-31"},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets = %+v", buckets)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, buckets[i], want[i])
+		}
+	}
+}
+
+// awal minggu dari MySQL (WEEKDAY, Senin = 0) cocok dengan label ISO week di Go
+func TestSumBucketsWeekClippedStart(t *testing.T) {
+	mock := newMockDB(t)
+	r := statsRange{from: mustDate("2025-01-01"), to: mustDate("2025-01-15"), granularity: granularityWeek}
+
+	mock.ExpectQuery(q("WEEKDAY(date)")).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "revenue", "expense", "profitloss"}).
+			AddRow("2024-12-30", 300.0, 100.0, 200.0).
+			AddRow("2025-01-13", 50.0, 0.0, 50.0))
+
+	buckets, err := sumBuckets(tenantOrgA, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 3 || buckets[0].Revenue != 300 || buckets[0].Start != "2025-01-01" || buckets[1].Revenue != 0 || buckets[2].ProfitLoss != 50 {
+		t.Fatalf("buckets = %+v", buckets)
+	}
+}
+
+func TestStatsRejectsInvalidRange(t *testing.T) {
+	newMockDB(t)
+	app := newTestApp(tenantUserA, tenantOrgA, orgRoleOwner)
+	app.Post("/api/profitloss/stats", getProfitLossStats)
+
+	for _, body := range []string{`{"granularity":"hour"}`, `{"from":"2025-05-02","to":"2025-05-01"}`, `{"from":"2000-01-01","granularity":"day"}`} {
+		if resp, out := doRequest(t, app, "POST", "/api/profitloss/stats", body); resp.StatusCode != 400 || !strings.Contains(out, errInvalidStatsRange.Error()) {
+			t.Errorf("body %s: status %d %s, want 400 invalid range", body, resp.StatusCode, out)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache response /api/profitloss/stats per organisasi.
+// Key = range + granularity request + tanggal hari ini (daily/monthly relatif ke hari ini).
+// Setiap perubahan data profit/loss organisasi membuang semua entry organisasi itu.
+type statsCacheEntry struct {
+	Body       []byte
+	ETag       string
+	ComputedAt time.Time // mulai dihitung; entry yang mulai sebelum Invalidate tidak disimpan
+}
+
+type statsCache interface {
+	Get(orgID int, key string) (statsCacheEntry, bool, error)
+	Set(orgID int, key string, entry statsCacheEntry) error
+	Invalidate(orgID int) error
+}
+
+var statsSummaries statsCache
+
+// =======================================
+// INIT: pilih backend dari env
+// =======================================
+func newStatsCacheFromEnv(ttl time.Duration) (statsCache, error) {
+	switch store := getEnv("STATS_CACHE_STORE", "memory"); store {
+	case "memory":
+		return &memoryStatsCache{
+			ttl:         ttl,
+			entries:     map[int]map[string]memoryStatsEntry{},
+			invalidated: map[int]time.Time{},
+		}, nil
+	case "none":
+		return noStatsCache{}, nil
+	default:
+		return nil, fmt.Errorf("unknown STATS_CACHE_STORE: %s", store)
+	}
+}
+
+func statsCacheKey(r statsRange, now time.Time) string {
+	return fmt.Sprintf("%s|%s|%s|%s",
+		r.from.Format("2006-01-02"), r.to.Format("2006-01-02"), r.granularity, now.Format("2006-01-02"))
+}
+
+// dipanggil setelah commit create/update/delete/ingest; gagal cukup di-log
+func invalidateStats(orgID int) {
+	if err := statsSummaries.Invalidate(orgID); err != nil {
+		log.Println("stats cache:", err)
+	}
+}
+
+// =======================================
+// HELPER: ETag / If-None-Match
+// =======================================
+func statsETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// If-None-Match bisa berisi beberapa ETag, "*" atau weak (W/"...")
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// =======================================
+// BACKEND: in-memory (single instance)
+// =======================================
+type memoryStatsEntry struct {
+	statsCacheEntry
+	expiresAt time.Time
+}
+
+type memoryStatsCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	entries     map[int]map[string]memoryStatsEntry
+	invalidated map[int]time.Time
+	size        int
+	lastSweep   time.Time
+}
+
+func (s *memoryStatsCache) Get(orgID int, key string) (statsCacheEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[orgID][key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return statsCacheEntry{}, false, nil
+	}
+	return e.statsCacheEntry, true, nil
+}
+
+func (s *memoryStatsCache) Set(orgID int, key string, entry statsCacheEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// data berubah selagi entry ini dihitung, atau hitungannya sudah lebih tua dari TTL
+	// (tanda invalidate setua itu sudah dibuang sweep, jadi tidak bisa dicek lagi)
+	if entry.ComputedAt.Before(s.invalidated[orgID]) || now.Sub(entry.ComputedAt) >= s.ttl {
+		return nil
+	}
+	if s.size > 10000 || now.Sub(s.lastSweep) >= s.ttl {
+		s.sweep(now)
+	}
+
+	keys := s.entries[orgID]
+	if keys == nil {
+		keys = map[string]memoryStatsEntry{}
+		s.entries[orgID] = keys
+	}
+	if _, ok := keys[key]; !ok {
+		s.size++
+	}
+	keys[key] = memoryStatsEntry{statsCacheEntry: entry, expiresAt: now.Add(s.ttl)}
+	return nil
+}
+
+func (s *memoryStatsCache) Invalidate(orgID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.size -= len(s.entries[orgID])
+	delete(s.entries, orgID)
+	s.invalidated[orgID] = now
+	if now.Sub(s.lastSweep) >= s.ttl {
+		s.sweep(now)
+	}
+	return nil
+}
+
+// buang entry kadaluarsa + tanda invalidate yang lebih tua dari TTL, supaya map tidak tumbuh terus
+func (s *memoryStatsCache) sweep(now time.Time) {
+	for org, keys := range s.entries {
+		for k, e := range keys {
+			if now.After(e.expiresAt) {
+				delete(keys, k)
+				s.size--
+			}
+		}
+		if len(keys) == 0 {
+			delete(s.entries, org)
+		}
+	}
+	for org, at := range s.invalidated {
+		if now.Sub(at) >= s.ttl {
+			delete(s.invalidated, org)
+		}
+	}
+	s.lastSweep = now
+}
+
+// =======================================
+// BACKEND: tanpa cache (STATS_CACHE_STORE=none)
+// =======================================
+type noStatsCache struct{}
+
+func (noStatsCache) Get(int, string) (statsCacheEntry, bool, error) {
+	return statsCacheEntry{}, false, nil
+}
+func (noStatsCache) Set(int, string, statsCacheEntry) error { return nil }
+func (noStatsCache) Invalidate(int) error                   { return nil }
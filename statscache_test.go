@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestStatsCache(ttl time.Duration) *memoryStatsCache {
+	return &memoryStatsCache{
+		ttl:         ttl,
+		entries:     map[int]map[string]memoryStatsEntry{},
+		invalidated: map[int]time.Time{},
+	}
+}
+
+func TestMemoryStatsCacheInvalidate(t *testing.T) {
+	c := newTestStatsCache(time.Minute)
+	c.Set(1, "k", statsCacheEntry{Body: []byte("a"), ComputedAt: time.Now()})
+	c.Set(2, "k", statsCacheEntry{Body: []byte("b"), ComputedAt: time.Now()})
+
+	c.Invalidate(1)
+	if _, ok, _ := c.Get(1, "k"); ok {
+		t.Error("org 1 entry survived Invalidate")
+	}
+	if e, ok, _ := c.Get(2, "k"); !ok || string(e.Body) != "b" {
+		t.Error("Invalidate(1) dropped org 2 entry")
+	}
+	if c.size != 1 {
+		t.Errorf("size = %d, want 1", c.size)
+	}
+}
+
+// hitungan yang mulai sebelum Invalidate tidak boleh masuk cache (data sudah berubah)
+func TestMemoryStatsCacheComputedAtGuard(t *testing.T) {
+	c := newTestStatsCache(time.Minute)
+
+	started := time.Now().Add(-time.Millisecond)
+	c.Invalidate(1)
+	c.Set(1, "k", statsCacheEntry{Body: []byte("stale"), ComputedAt: started})
+	if _, ok, _ := c.Get(1, "k"); ok {
+		t.Fatal("entry computed before Invalidate was cached")
+	}
+
+	c.Set(1, "k", statsCacheEntry{Body: []byte("fresh"), ComputedAt: time.Now().Add(time.Millisecond)})
+	if e, ok, _ := c.Get(1, "k"); !ok || string(e.Body) != "fresh" {
+		t.Fatal("entry computed after Invalidate was not cached")
+	}
+
+	// lebih tua dari TTL: tanda invalidate-nya mungkin sudah di-sweep, jadi ditolak juga
+	c.Set(2, "k", statsCacheEntry{Body: []byte("old"), ComputedAt: time.Now().Add(-2 * time.Minute)})
+	if _, ok, _ := c.Get(2, "k"); ok {
+		t.Fatal("entry older than TTL was cached")
+	}
+}
+
+func TestMemoryStatsCacheSweep(t *testing.T) {
+	c := newTestStatsCache(time.Minute)
+	now := time.Now()
+	c.invalidated[1] = now.Add(-2 * time.Minute)
+	c.invalidated[2] = now.Add(-time.Second)
+	c.entries[3] = map[string]memoryStatsEntry{"k": {expiresAt: now.Add(-time.Second)}}
+	c.size = 1
+
+	// lastSweep nol -> Invalidate berikutnya menjalankan sweep
+	c.Invalidate(4)
+
+	if _, ok := c.invalidated[1]; ok {
+		t.Error("invalidated mark older than TTL not pruned")
+	}
+	if _, ok := c.invalidated[2]; !ok {
+		t.Error("recent invalidated mark pruned")
+	}
+	if _, ok := c.entries[3]; ok || c.size != 0 {
+		t.Errorf("expired entry not pruned (size %d)", c.size)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"abc123"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc123"`, true},
+		{`W/"abc123"`, true},
+		{`"zzz", W/"abc123"`, true},
+		{`"zzz","abc123"`, true},
+		{`*`, true},
+		{`"zzz"`, false},
+		{`abc123`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// cache hit: tidak ada query ke database, If-None-Match yang cocok -> 304 tanpa body
+func TestProfitLossStatsNotModified(t *testing.T) {
+	newMockDB(t)
+
+	prev := statsSummaries
+	cache := newTestStatsCache(time.Minute)
+	statsSummaries = cache
+	t.Cleanup(func() { statsSummaries = prev })
+
+	now := time.Now()
+	rng, err := parseStatsRange(StatsRequest{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"data":[]}`)
+	etag := statsETag(body)
+	cache.Set(tenantOrgA, statsCacheKey(rng, now), statsCacheEntry{Body: body, ETag: etag, ComputedAt: now})
+
+	app := newTestApp(tenantUserA, tenantOrgA, orgRoleOwner)
+	app.Post("/api/profitloss/stats", getProfitLossStats)
+
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag} {
+		resp, out := doRequest(t, app, "POST", "/api/profitloss/stats", "", fiber.HeaderIfNoneMatch, header)
+		if resp.StatusCode != 304 || out != "" || resp.Header.Get(fiber.HeaderETag) != etag {
+			t.Errorf("If-None-Match %s: status %d etag %q body %q", header, resp.StatusCode, resp.Header.Get(fiber.HeaderETag), out)
+		}
+	}
+
+	resp, out := doRequest(t, app, "POST", "/api/profitloss/stats", "", fiber.HeaderIfNoneMatch, `"other"`)
+	if resp.StatusCode != 200 || out != string(body) {
+		t.Fatalf("stale ETag: status %d body %s", resp.StatusCode, out)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template email: templates/email/<name>.<locale>.txt dan .html.
+// File .txt wajib punya {{define "subject"}}.
+//
+//go:embed templates/email
+var emailTemplatesFS embed.FS
+
+const defaultLocale = "id"
+
+var supportedLocales = map[string]bool{"id": true, "en": true}
+
+// helper normalisasi locale ("en-US" -> "en"), fallback ke defaultLocale
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	if !supportedLocales[locale] {
+		return defaultLocale
+	}
+	return locale
+}
+
+// =======================================
+// RENDER EMAIL
+// =======================================
+func renderEmail(name, locale, to string, data any) (Message, error) {
+	base := "templates/email/" + name + "." + normalizeLocale(locale)
+
+	txt, err := texttemplate.ParseFS(emailTemplatesFS, base+".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	var subject, text bytes.Buffer
+	if err := txt.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := txt.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+
+	html, err := htmltemplate.ParseFS(emailTemplatesFS, base+".html")
+	if err != nil {
+		return Message{}, err
+	}
+	var body bytes.Buffer
+	if err := html.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    body.String(),
+	}, nil
+}
@@ -8,19 +8,14 @@ import (
 
 // GET all tickets for user
 func getAllTicket(c *fiber.Ctx) error {
-	req := new(struct {
-		UserID int `json:"userID"`
-	})
-	if err := c.BodyParser(req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
-	}
+	orgID := currentOrgID(c)
 
 	rows, err := db.Query(`
-		SELECT id, user_id, product_id, description, status, created_at, updated_at 
+		SELECT id, user_id, organization_id, product_id, description, status, created_at, updated_at 
 		FROM tickets 
-		WHERE user_id = ? 
+		WHERE organization_id = ? 
 		ORDER BY created_at DESC
-	`, req.UserID)
+	`, orgID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -29,7 +24,7 @@ func getAllTicket(c *fiber.Ctx) error {
 	var tickets []Ticket
 	for rows.Next() {
 		var t Ticket
-		if err := rows.Scan(&t.ID, &t.UserID, &t.ProductID, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.UserID, &t.OrganizationID, &t.ProductID, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt); err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
 		tickets = append(tickets, t)
@@ -41,8 +36,8 @@ func getAllTicket(c *fiber.Ctx) error {
 func getTicketByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var t Ticket
-	err := db.QueryRow("SELECT id, user_id, product_id, description, status, created_at, updated_at FROM tickets WHERE id = ?", id).
-		Scan(&t.ID, &t.UserID, &t.ProductID, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt)
+	err := db.QueryRow("SELECT id, user_id, organization_id, product_id, description, status, created_at, updated_at FROM tickets WHERE id = ? AND organization_id = ?", id, currentOrgID(c)).
+		Scan(&t.ID, &t.UserID, &t.OrganizationID, &t.ProductID, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return c.Status(404).JSON(fiber.Map{"error": "not found"})
@@ -52,34 +47,48 @@ func getTicketByID(c *fiber.Ctx) error {
 	return c.JSON(t)
 }
 
-// CREATE ticket (product_id = 1)
+// CREATE ticket
 func createTicket(c *fiber.Ctx) error {
 	t := new(Ticket)
 	if err := c.BodyParser(t); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
 
-	if t.UserID == 0 || t.AppKey == "" || t.Description == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "user_id, app_key, and description required"})
+	// user_id & organisasi selalu dari token/header, bukan dari body
+	t.UserID = currentUserID(c)
+	t.OrganizationID = currentOrgID(c)
+
+	if t.Description == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "description required"})
 	}
 
-	// cek validasi app_key
-	var valid int
-	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE id=? AND app_key=?", t.UserID, t.AppKey).Scan(&valid)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	// product_id dari body, default produk ini. Akses ke produk ini sudah dicek di route
+	// (requireEntitlement); tiket untuk produk lain butuh entitlement produk itu juga.
+	if t.ProductID == 0 {
+		t.ProductID = productProfitLoss
 	}
-	if valid == 0 {
-		return c.Status(403).JSON(fiber.Map{"error": "invalid credentials"})
+	if t.ProductID != productProfitLoss {
+		entitled, err := hasEntitlement(t.UserID, t.ProductID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !entitled {
+			return c.Status(403).JSON(fiber.Map{"error": "user does not have access to this product"})
+		}
 	}
 
-	t.ProductID = 1
 	t.Status = "open"
 
-	res, err := db.Exec(`
-		INSERT INTO tickets (user_id, product_id, description, status) 
-		VALUES (?, ?, ?, ?)
-	`, t.UserID, t.ProductID, t.Description, t.Status)
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO tickets (user_id, organization_id, product_id, description, status) 
+		VALUES (?, ?, ?, ?, ?)
+	`, t.UserID, t.OrganizationID, t.ProductID, t.Description, t.Status)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -87,9 +96,37 @@ func createTicket(c *fiber.Ctx) error {
 	id, _ := res.LastInsertId()
 	t.ID = int(id)
 
+	// notifikasi tiket diterima ke user
+	msg, err := ticketCreatedEmail(tx, t)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := enqueueEmail(tx, msg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.JSON(t)
 }
 
+// HELPER: email notifikasi tiket baru
+func ticketCreatedEmail(tx *sql.Tx, t *Ticket) (Message, error) {
+	var email, name, locale string
+	err := tx.QueryRow("SELECT email, name, locale FROM users WHERE id = ?", t.UserID).Scan(&email, &name, &locale)
+	if err != nil {
+		return Message{}, err
+	}
+	return renderEmail("ticket_created", locale, email, map[string]any{
+		"Name":        name,
+		"TicketID":    t.ID,
+		"Status":      t.Status,
+		"Description": t.Description,
+	})
+}
+
 // UPDATE ticket (description + status)
 func updateTicket(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -98,9 +135,13 @@ func updateTicket(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
 	}
 
-	_, err := db.Exec("UPDATE tickets SET description=? WHERE id=?",
-		t.Description, id)
+	t.OrganizationID = currentOrgID(c)
+	err := execOwned("UPDATE tickets SET description=? WHERE id=? AND organization_id=?",
+		t.Description, id, t.OrganizationID)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -111,8 +152,11 @@ func updateTicket(c *fiber.Ctx) error {
 // DELETE ticket
 func deleteTicket(c *fiber.Ctx) error {
 	id := c.Params("id")
-	_, err := db.Exec("DELETE FROM tickets WHERE id=?", id)
+	err := execOwned("DELETE FROM tickets WHERE id=? AND organization_id=?", id, currentOrgID(c))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(404).JSON(fiber.Map{"error": "not found"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(fiber.Map{"message": "deleted"})
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// tiket id 7 milik organisasi A; request sebagai user B di organisasi B (lihat profitloss_test.go)
+func TestTicketCrossTenant(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:   "getTicketByID",
+			method: "GET",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(q("FROM tickets WHERE id = ? AND organization_id = ?")).
+					WithArgs("7", tenantOrgB).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "product_id", "description", "status", "created_at", "updated_at"}))
+			},
+		},
+		{
+			name:   "updateTicket",
+			method: "PUT",
+			body:   `{"description":"diambil alih"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(q("UPDATE tickets SET description=? WHERE id=? AND organization_id=?")).
+					WithArgs("diambil alih", "7", tenantOrgB).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name:   "deleteTicket",
+			method: "DELETE",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(q("DELETE FROM tickets WHERE id=? AND organization_id=?")).
+					WithArgs("7", tenantOrgB).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockDB(t)
+			tt.expect(mock)
+
+			app := newTestApp(tenantUserB, tenantOrgB, orgRoleOwner)
+			app.Get("/api/ticket/:id", getTicketByID)
+			app.Put("/api/ticket/:id", updateTicket)
+			app.Delete("/api/ticket/:id", deleteTicket)
+
+			resp, body := doRequest(t, app, tt.method, "/api/ticket/7", tt.body)
+			if resp.StatusCode != 404 {
+				t.Fatalf("status = %d, want 404 (body %s)", resp.StatusCode, body)
+			}
+
+			// tiket masih utuh untuk pemiliknya
+			mock.ExpectQuery(q("FROM tickets WHERE id = ? AND organization_id = ?")).
+				WithArgs("7", tenantOrgA).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "organization_id", "product_id", "description", "status", "created_at", "updated_at"}).
+					AddRow(tenantRowID, tenantUserA, tenantOrgA, 1, "printer rusak", "open", "2025-01-01 08:00:00", "2025-01-01 08:00:00"))
+
+			owner := newTestApp(tenantUserA, tenantOrgA, orgRoleOwner)
+			owner.Get("/api/ticket/:id", getTicketByID)
+			resp, body = doRequest(t, owner, "GET", "/api/ticket/7", "")
+			if resp.StatusCode != 200 || !strings.Contains(body, `"description":"printer rusak"`) {
+				t.Fatalf("owner read: status %d body %s", resp.StatusCode, body)
+			}
+		})
+	}
+}
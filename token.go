@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Token type yang disimpan di claim "typ"
+const tokenTypeAccess = "access"
+
+// key untuk c.Locals
+const localsUserID = "userID"
+
+var (
+	tokenSecret     []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	errInvalidToken = errors.New("invalid token")
+	errExpiredToken = errors.New("token expired")
+)
+
+// header JWT tetap, kita hanya pakai HS256
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type tokenClaims struct {
+	Sub int    `json:"sub"`
+	Typ string `json:"typ"`
+	Ver int    `json:"ver,omitempty"` // users.token_version saat token dibuat
+	Iat int64  `json:"iat"`
+	Exp int64  `json:"exp"`
+}
+
+// =======================================
+// INIT: baca secret & TTL dari env
+// =======================================
+func initTokenConfig(stage string) {
+	secret := getEnv("APP_SECRET", "")
+	if secret == "" {
+		if stage != "dev" {
+			log.Fatal("APP_SECRET must be set outside dev stage")
+		}
+		// dev: secret random, token tidak berlaku lagi setelah restart
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatal(err)
+		}
+		secret = string(buf)
+		log.Println("APP_SECRET not set, using random secret for this process")
+	}
+	tokenSecret = []byte(secret)
+
+	ttl, err := time.ParseDuration(getEnv("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil {
+		log.Fatal("invalid ACCESS_TOKEN_TTL: ", err)
+	}
+	accessTokenTTL = ttl
+
+	ttl, err = time.ParseDuration(getEnv("REFRESH_TOKEN_TTL", "720h"))
+	if err != nil {
+		log.Fatal("invalid REFRESH_TOKEN_TTL: ", err)
+	}
+	refreshTokenTTL = ttl
+}
+
+// =======================================
+// SIGN & PARSE
+// =======================================
+func signToken(userID int, typ string, version int, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	exp := now.Add(ttl)
+	payload, err := json.Marshal(tokenClaims{
+		Sub: userID,
+		Typ: typ,
+		Ver: version,
+		Iat: now.Unix(),
+		Exp: exp.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(unsigned), exp, nil
+}
+
+func parseToken(raw string, typ string) (*tokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, errInvalidToken
+	}
+
+	expected := tokenSignature(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	claims := new(tokenClaims)
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	if claims.Typ != typ || claims.Sub == 0 {
+		return nil, errInvalidToken
+	}
+	if time.Now().Unix() >= claims.Exp {
+		return nil, errExpiredToken
+	}
+	return claims, nil
+}
+
+func tokenSignature(unsigned string) string {
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// =======================================
+// MIDDLEWARE: wajib login
+// =======================================
+func authRequired(c *fiber.Ctx) error {
+	header := c.Get(fiber.HeaderAuthorization)
+	raw, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || raw == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "missing bearer token"})
+	}
+
+	claims, err := parseToken(raw, tokenTypeAccess)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+
+	// token yang terbit sebelum reset password / logout semua perangkat ditolak
+	version, err := userTokenVersion(db, claims.Sub)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or expired token"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if version != claims.Ver {
+		return c.Status(401).JSON(fiber.Map{"error": "session revoked, please login again"})
+	}
+
+	c.Locals(localsUserID, claims.Sub)
+	return c.Next()
+}
+
+func userTokenVersion(q dbtx, userID int) (int, error) {
+	var version int
+	err := q.QueryRow("SELECT token_version FROM users WHERE id = ?", userID).Scan(&version)
+	return version, err
+}
+
+// helper ambil user id hasil authRequired
+func currentUserID(c *fiber.Ctx) int {
+	id, _ := c.Locals(localsUserID).(int)
+	return id
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TOTP (RFC 6238): SHA1, 6 digit, periode 30 detik
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // toleransi +-1 periode
+	totpIssuer        = "MyDash"
+	recoveryCodeCount = 10
+
+	// token sementara antara langkah password dan langkah kode 2FA (sekali pakai, lihat user_tokens)
+	twoFactorTokenTTL = 5 * time.Minute
+)
+
+// clock bisa diganti (fake clock) saat test
+var clock = time.Now
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// =======================================
+// TOTP
+// =======================================
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// cek kode terhadap waktu sekarang; step yang sudah pernah dipakai (<= lastStep) ditolak
+func verifyTOTP(secretB32, code string, lastStep int64) (int64, bool) {
+	secret, err := base32NoPad.DecodeString(secretB32)
+	if err != nil {
+		return 0, false
+	}
+	code = strings.TrimSpace(code)
+
+	current := clock().Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// =======================================
+// HELPER: recovery code (format xxxxx-xxxxx)
+// =======================================
+func newRecoveryCode() (string, error) {
+	const letters = "abcdefghijkmnpqrstuvwxyz23456789"
+	buf := make([]byte, 10)
+	for i := range buf {
+		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", err
+		}
+		buf[i] = letters[num.Int64()]
+	}
+	return string(buf[:5]) + "-" + string(buf[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+// =======================================
+// HELPER: status 2FA user
+// =======================================
+func twoFactorEnabled(userID int) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM user_two_factor WHERE user_id = ? AND confirmed_at IS NOT NULL", userID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// =======================================
+// SETUP 2FA (generate secret, belum aktif)
+// =======================================
+func twoFactorSetupProcess(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+
+	enabled, err := twoFactorEnabled(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if enabled {
+		return c.Status(400).JSON(fiber.Map{"error": "two-factor authentication already enabled"})
+	}
+
+	var email string
+	if err := db.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	secret := base32NoPad.EncodeToString(raw)
+
+	// setup ulang menimpa secret yang belum dikonfirmasi
+	_, err = db.Exec(`
+		REPLACE INTO user_two_factor (user_id, secret, confirmed_at, last_used_step, created_at)
+		VALUES (?, ?, NULL, 0, ?)
+	`, userID, secret, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + email)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": "otpauth://totp/" + label + "?" + params.Encode(),
+	})
+}
+
+// =======================================
+// CONFIRM 2FA (aktifkan + recovery codes)
+// =======================================
+func twoFactorConfirmProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Code string `json:"code"`
+	})
+	if err := c.BodyParser(req); err != nil || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	userID := currentUserID(c)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	var secret string
+	err = tx.QueryRow(
+		"SELECT secret FROM user_two_factor WHERE user_id = ? AND confirmed_at IS NULL FOR UPDATE", userID,
+	).Scan(&secret)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c.Status(400).JSON(fiber.Map{"error": "two-factor setup not started or already enabled"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	step, ok := verifyTOTP(secret, req.Code, 0)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid code"})
+	}
+
+	_, err = tx.Exec(
+		"UPDATE user_two_factor SET confirmed_at = ?, last_used_step = ? WHERE user_id = ?",
+		time.Now(), step, userID,
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func replaceRecoveryCodes(ex execer, userID int) ([]string, error) {
+	if _, err := ex.Exec("DELETE FROM two_factor_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = ex.Exec(
+			"INSERT INTO two_factor_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)",
+			userID, hashToken(code), time.Now(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// =======================================
+// DISABLE 2FA (wajib password)
+// =======================================
+func twoFactorDisableProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		Password string `json:"password"`
+	})
+	if err := c.BodyParser(req); err != nil || req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+	userID := currentUserID(c)
+
+	var hashedPassword string
+	if err := db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&hashedPassword); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "password is incorrect"})
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM user_two_factor WHERE user_id = ?", userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "two-factor authentication disabled"})
+}
+
+// =======================================
+// LOGIN STEP 2: kode TOTP / recovery code
+// =======================================
+func twoFactorLoginProcess(c *fiber.Ctx) error {
+	req := new(struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	})
+	if err := c.BodyParser(req); err != nil || req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	// challenge baru ditandai terpakai kalau kode benar (commit); kode salah = rollback, masih bisa dicoba lagi
+	tx, err := db.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer tx.Rollback()
+
+	userID, err := consumeUserToken(tx, purposeLogin2FA, req.ChallengeToken)
+	if err != nil {
+		if err == errUserTokenInvalid {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or expired challenge, please login again"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// brute-force kode 2FA dibatasi per user
+	throttleKey := fmt.Sprintf("2fa:%d", userID)
+	st, err := loginAttempts.Get(throttleKey)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if wait := time.Until(st.BlockedUntil); wait > 0 {
+		return tooManyLoginAttempts(c, wait)
+	}
+
+	// kode ikut transaksi login: kalau sesi gagal dibuat, recovery code / step TOTP tidak hangus
+	ok, err := consumeTwoFactorCode(tx, userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		if st, err := loginAttempts.Fail(throttleKey, time.Now(), accountThrottle.block); err == nil && st.Failures == accountThrottle.lockAfter {
+			recordAuthEvent(userID, "", c.IP(), "login_lockout:2fa")
+		}
+		return c.Status(401).JSON(fiber.Map{"error": "invalid code"})
+	}
+	loginAttempts.Reset(throttleKey)
+
+	user, err := getUserByID(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	session, err := issueSession(c, tx, userID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to issue token"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	session["message"] = "login success"
+	session["user"] = user
+	return c.JSON(session)
+}
+
+// kode TOTP (sekali per periode) atau recovery code (sekali pakai)
+func consumeTwoFactorCode(ex dbtx, userID int, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		err := execOwnedTx(ex,
+			"UPDATE two_factor_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+			time.Now(), userID, hashToken(normalizeRecoveryCode(recoveryCode)),
+		)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	var (
+		secret   string
+		lastStep int64
+	)
+	err := ex.QueryRow(
+		"SELECT secret, last_used_step FROM user_two_factor WHERE user_id = ? AND confirmed_at IS NOT NULL", userID,
+	).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := verifyTOTP(secret, code, lastStep)
+	if !ok {
+		return false, nil
+	}
+
+	// tandai step terpakai; kalau request lain sudah memakai step ini, tolak
+	err = execOwnedTx(ex,
+		"UPDATE user_two_factor SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?",
+		step, userID, step,
+	)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
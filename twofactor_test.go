@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// secret tetap (base32) + jam palsu supaya kode TOTP bisa dihitung di test
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+var testNow = time.Date(2025, 3, 1, 10, 0, 15, 0, time.UTC)
+
+func setClock(t *testing.T, now time.Time) {
+	t.Helper()
+	prev := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = prev })
+}
+
+func testTOTPAt(t *testing.T, offset int64) string {
+	t.Helper()
+	secret, err := base32NoPad.DecodeString(testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(secret, testNow.Unix()/totpPeriod+offset)
+}
+
+func TestVerifyTOTPWindow(t *testing.T) {
+	setClock(t, testNow)
+	current := testNow.Unix() / totpPeriod
+
+	for _, offset := range []int64{-1, 0, 1} {
+		step, ok := verifyTOTP(testTOTPSecret, testTOTPAt(t, offset), 0)
+		if !ok || step != current+offset {
+			t.Errorf("offset %d: got (%d, %v), want (%d, true)", offset, step, ok, current+offset)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if _, ok := verifyTOTP(testTOTPSecret, testTOTPAt(t, offset), 0); ok {
+			t.Errorf("offset %d: accepted outside the +-%d step window", offset, totpSkew)
+		}
+	}
+
+	// step yang sudah dipakai tidak bisa dipakai lagi
+	if _, ok := verifyTOTP(testTOTPSecret, testTOTPAt(t, 0), current); ok {
+		t.Error("reused step accepted")
+	}
+}
+
+func TestTwoFactorSetup(t *testing.T) {
+	mock := newMockDB(t)
+	secret := &captureArg{}
+
+	mock.ExpectQuery(q("SELECT COUNT(*) FROM user_two_factor")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(q("SELECT email FROM users WHERE id = ?")).
+		WithArgs(tenantUserA).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("budi@example.com"))
+	mock.ExpectExec(q("REPLACE INTO user_two_factor")).
+		WithArgs(tenantUserA, secret, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := newTestApp(tenantUserA, 0, "")
+	app.Post("/api/2fa/setup", twoFactorSetupProcess)
+	resp, body := doRequest(t, app, "POST", "/api/2fa/setup", "")
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d body %s", resp.StatusCode, body)
+	}
+
+	var out struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Secret == "" || out.Secret != secret.value {
+		t.Fatalf("secret %q not the one stored (%q)", out.Secret, secret.value)
+	}
+	if !strings.HasPrefix(out.OtpauthURI, "otpauth://totp/") || !strings.Contains(out.OtpauthURI, "secret="+out.Secret) {
+		t.Fatalf("otpauth_uri = %s", out.OtpauthURI)
+	}
+}
+
+func TestTwoFactorConfirm(t *testing.T) {
+	setClock(t, testNow)
+	step := testNow.Unix() / totpPeriod
+
+	t.Run("invalid code", func(t *testing.T) {
+		mock := newMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(q("SELECT secret FROM user_two_factor WHERE user_id = ? AND confirmed_at IS NULL FOR UPDATE")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"secret"}).AddRow(testTOTPSecret))
+		mock.ExpectRollback()
+
+		app := newTestApp(tenantUserA, 0, "")
+		app.Post("/api/2fa/confirm", twoFactorConfirmProcess)
+		resp, body := doRequest(t, app, "POST", "/api/2fa/confirm", `{"code":"`+testTOTPAt(t, 2)+`"}`)
+		if resp.StatusCode != 400 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("valid code", func(t *testing.T) {
+		mock := newMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(q("SELECT secret FROM user_two_factor WHERE user_id = ? AND confirmed_at IS NULL FOR UPDATE")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"secret"}).AddRow(testTOTPSecret))
+		mock.ExpectExec(q("UPDATE user_two_factor SET confirmed_at = ?, last_used_step = ?")).
+			WithArgs(sqlmock.AnyArg(), step, tenantUserA).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(q("DELETE FROM two_factor_recovery_codes WHERE user_id = ?")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		for i := 0; i < recoveryCodeCount; i++ {
+			mock.ExpectExec(q("INSERT INTO two_factor_recovery_codes")).
+				WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+		}
+		mock.ExpectCommit()
+
+		app := newTestApp(tenantUserA, 0, "")
+		app.Post("/api/2fa/confirm", twoFactorConfirmProcess)
+		resp, body := doRequest(t, app, "POST", "/api/2fa/confirm", `{"code":"`+testTOTPAt(t, 0)+`"}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+		var out struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		if err := json.Unmarshal([]byte(body), &out); err != nil {
+			t.Fatal(err)
+		}
+		if len(out.RecoveryCodes) != recoveryCodeCount {
+			t.Fatalf("got %d recovery codes, want %d", len(out.RecoveryCodes), recoveryCodeCount)
+		}
+	})
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	setClock(t, testNow)
+	step := testNow.Unix() / totpPeriod
+
+	prevAttempts := loginAttempts
+	loginAttempts = &memoryAttemptStore{entries: map[string]loginAttempt{}}
+	t.Cleanup(func() { loginAttempts = prevAttempts })
+
+	const challenge = "challenge-token"
+	tokenCols := []string{"id", "user_id", "data", "used_at", "expired"}
+
+	expectChallenge := func(mock sqlmock.Sqlmock, usedAt any) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(q("FROM user_tokens")).
+			WithArgs(sqlmock.AnyArg(), hashToken(challenge), purposeLogin2FA).
+			WillReturnRows(sqlmock.NewRows(tokenCols).AddRow(3, tenantUserA, "", usedAt, false))
+	}
+	expectSecret := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(q("SELECT secret, last_used_step FROM user_two_factor")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"secret", "last_used_step"}).AddRow(testTOTPSecret, step-5))
+	}
+
+	app := newTestApp(0, 0, "")
+	app.Post("/api/login/2fa", twoFactorLoginProcess)
+
+	t.Run("wrong code keeps challenge", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectChallenge(mock, nil)
+		mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE id = ?")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectSecret(mock)
+		mock.ExpectRollback()
+
+		resp, body := doRequest(t, app, "POST", "/api/login/2fa",
+			`{"challenge_token":"`+challenge+`","code":"`+testTOTPAt(t, 3)+`"}`)
+		if resp.StatusCode != 401 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("valid code consumes challenge", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectChallenge(mock, nil)
+		mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE id = ?")).
+			WithArgs(sqlmock.AnyArg(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectSecret(mock)
+		mock.ExpectExec(q("UPDATE user_two_factor SET last_used_step = ?")).
+			WithArgs(step+1, tenantUserA, step+1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(q("FROM users")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "role_id", "name", "email", "organization", "whatsapp", "locale"}).
+				AddRow(tenantUserA, 3, "Budi", "budi@example.com", "Toko Budi", "", "id"))
+		mock.ExpectQuery(q("FROM user_product_entitlements")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec(q("INSERT INTO refresh_tokens")).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(q("SELECT token_version FROM users WHERE id = ?")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(0))
+		mock.ExpectCommit()
+
+		resp, body := doRequest(t, app, "POST", "/api/login/2fa",
+			`{"challenge_token":"`+challenge+`","code":"`+testTOTPAt(t, 1)+`"}`)
+		if resp.StatusCode != 200 || !strings.Contains(body, `"token"`) {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+
+	// recovery code dipakai di transaksi login: sesi gagal dibuat -> rollback, code masih berlaku
+	t.Run("recovery code kept when session fails", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectChallenge(mock, nil)
+		mock.ExpectExec(q("UPDATE user_tokens SET used_at = ? WHERE id = ?")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(q("UPDATE two_factor_recovery_codes SET used_at = ?")).
+			WithArgs(sqlmock.AnyArg(), tenantUserA, hashToken("abcde-fghjk")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(q("FROM users")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "role_id", "name", "email", "organization", "whatsapp", "locale"}).
+				AddRow(tenantUserA, 3, "Budi", "budi@example.com", "Toko Budi", "", "id"))
+		mock.ExpectQuery(q("FROM user_product_entitlements")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec(q("INSERT INTO refresh_tokens")).
+			WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		resp, body := doRequest(t, app, "POST", "/api/login/2fa",
+			`{"challenge_token":"`+challenge+`","recovery_code":"abcde-fghjk"}`)
+		if resp.StatusCode != 500 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("replayed challenge rejected", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectChallenge(mock, "2025-03-01 10:00:20")
+		mock.ExpectRollback()
+
+		resp, body := doRequest(t, app, "POST", "/api/login/2fa",
+			`{"challenge_token":"`+challenge+`","code":"`+testTOTPAt(t, 0)+`"}`)
+		if resp.StatusCode != 401 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	mock := newMockDB(t)
+	const code = "abcde-fghjk"
+
+	mock.ExpectExec(q("UPDATE two_factor_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), tenantUserA, hashToken(code)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(q("UPDATE two_factor_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), tenantUserA, hashToken(code)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// huruf besar + spasi dinormalisasi ke bentuk yang sama
+	if ok, err := consumeTwoFactorCode(db, tenantUserA, "", " ABCDE-FGHJK "); err != nil || !ok {
+		t.Fatalf("first use: got (%v, %v), want (true, nil)", ok, err)
+	}
+	if ok, err := consumeTwoFactorCode(db, tenantUserA, "", code); err != nil || ok {
+		t.Fatalf("second use: got (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestTwoFactorDisableRequiresPassword(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("rahasia-kuat-123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPassword := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(q("SELECT password FROM users WHERE id = ?")).
+			WithArgs(tenantUserA).
+			WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hashed)))
+	}
+
+	app := newTestApp(tenantUserA, 0, "")
+	app.Post("/api/2fa/disable", twoFactorDisableProcess)
+
+	t.Run("missing password", func(t *testing.T) {
+		newMockDB(t)
+		resp, body := doRequest(t, app, "POST", "/api/2fa/disable", `{}`)
+		if resp.StatusCode != 400 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectPassword(mock)
+		resp, body := doRequest(t, app, "POST", "/api/2fa/disable", `{"password":"salah-sekali-1"}`)
+		if resp.StatusCode != 400 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("correct password", func(t *testing.T) {
+		mock := newMockDB(t)
+		expectPassword(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(q("DELETE FROM user_two_factor WHERE user_id = ?")).
+			WithArgs(tenantUserA).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(q("DELETE FROM two_factor_recovery_codes WHERE user_id = ?")).
+			WithArgs(tenantUserA).
+			WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectCommit()
+
+		resp, body := doRequest(t, app, "POST", "/api/2fa/disable", `{"password":"rahasia-kuat-123"}`)
+		if resp.StatusCode != 200 {
+			t.Fatalf("status %d body %s", resp.StatusCode, body)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Token sekali pakai yang dikirim lewat email (verifikasi, dll).
+// Yang disimpan hanya hash-nya, token mentah hanya ada di link email.
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposePasswordReset = "password_reset"
+	purposeChangeEmail   = "change_email" // data = email baru
+	purposeDeleteAccount = "delete_account"
+	purposeLogin2FA      = "login_2fa"
+)
+
+var errUserTokenInvalid = errors.New("token invalid, expired or already used")
+
+// =======================================
+// CREATE: token baru menggantikan token lama dengan purpose sama
+// =======================================
+func createUserToken(ex execer, userID int, purpose string, ttl time.Duration) (string, error) {
+	return createUserTokenWithData(ex, userID, purpose, "", ttl)
+}
+
+// sama seperti createUserToken, plus data tambahan yang ikut disimpan (mis. email baru)
+func createUserTokenWithData(ex execer, userID int, purpose, data string, ttl time.Duration) (string, error) {
+	raw, err := generateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	// token lama yang belum dipakai dianggap hangus
+	_, err = ex.Exec(
+		"UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		now, userID, purpose,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = ex.Exec(`
+		INSERT INTO user_tokens (user_id, purpose, token_hash, data, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, purpose, hashToken(raw), data, now.Add(ttl), now)
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// =======================================
+// CONSUME: validasi + tandai terpakai (di dalam transaksi)
+// =======================================
+func consumeUserToken(tx *sql.Tx, purpose, raw string) (int, error) {
+	userID, _, err := consumeUserTokenData(tx, purpose, raw)
+	return userID, err
+}
+
+// sama seperti consumeUserToken, plus data yang disimpan createUserTokenWithData
+func consumeUserTokenData(tx *sql.Tx, purpose, raw string) (int, string, error) {
+	var (
+		id      int
+		userID  int
+		data    string
+		usedAt  sql.NullString
+		expired bool
+	)
+	err := tx.QueryRow(`
+		SELECT id, user_id, data, used_at, expires_at <= ?
+		FROM user_tokens
+		WHERE token_hash = ? AND purpose = ?
+		FOR UPDATE
+	`, time.Now(), hashToken(raw), purpose).Scan(&id, &userID, &data, &usedAt, &expired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, "", errUserTokenInvalid
+		}
+		return 0, "", err
+	}
+	if usedAt.Valid || expired {
+		return 0, "", errUserTokenInvalid
+	}
+
+	if _, err := tx.Exec("UPDATE user_tokens SET used_at = ? WHERE id = ?", time.Now(), id); err != nil {
+		return 0, "", err
+	}
+	return userID, data, nil
+}
+
+// =======================================
+// THROTTLE: boleh kirim token baru atau belum
+// =======================================
+// minInterval = jeda minimal antar token, maxPerHour = batas token per jam
+func userTokenThrottled(userID int, purpose string, minInterval time.Duration, maxPerHour int) (bool, error) {
+	now := time.Now()
+	var (
+		countLastHour int
+		tooSoon       bool
+	)
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(MAX(created_at) > ?, 0)
+		FROM user_tokens
+		WHERE user_id = ? AND purpose = ? AND created_at > ?
+	`, now.Add(-minInterval), userID, purpose, now.Add(-time.Hour)).Scan(&countLastHour, &tooSoon)
+	if err != nil {
+		return false, err
+	}
+	return tooSoon || countLastHour >= maxPerHour, nil
+}